@@ -0,0 +1,121 @@
+package ignition
+
+import "time"
+
+// 自适应调整动作
+const (
+	AdaptiveGrow   = "grow"
+	AdaptiveShrink = "shrink"
+	AdaptiveHold   = "hold"
+)
+
+const (
+	// 默认目标平均等待时间
+	defaultTargetWait = 10 * time.Millisecond
+)
+
+// 自适应连接数上限
+// 由维护协程每个周期根据等待时间和延迟调整MaxActive，需同时设置MaintenanceInterval
+// 调用方平均等待超过TargetWait时调大，新建连接或借用的平均耗时超过MaxLatency时视为数据库过载并调小
+type Adaptive struct {
+	// 调整范围，MaxActive为0表示不限制
+	// 连接池未设置上限时，首次调整从MaxActive开始
+	MinActive int
+	MaxActive int
+	// 目标平均等待时间，默认10ms
+	TargetWait time.Duration
+	// 新建连接和借用连接的平均耗时上限，0表示不检查
+	MaxLatency time.Duration
+	// 每次调整的连接数，默认1
+	Step int
+}
+
+// 自适应调整的最近一次决定
+type AdaptiveDecision struct {
+	At      time.Time     // 决定时间
+	Action  string        // AdaptiveGrow、AdaptiveShrink或AdaptiveHold
+	Limit   int           // 调整后的MaxActive
+	AvgWait time.Duration // 本周期平均等待时间
+	AvgDial time.Duration // 本周期新建连接平均耗时
+	AvgHold time.Duration // 本周期连接平均借用时长
+}
+
+// 按本周期的统计调整MaxActive
+func (p *Pool[T]) adapt() {
+	p.mu.Lock()
+	a := p.Adaptive
+	if a == nil || p.closed {
+		p.mu.Unlock()
+		return
+	}
+	cur, last := p.stats, p.adaptiveLast
+	p.adaptiveLast = cur
+
+	d := AdaptiveDecision{
+		At:      time.Now(),
+		Action:  AdaptiveHold,
+		AvgWait: average(cur.waitDuration-last.waitDuration, cur.waitCount-last.waitCount),
+		AvgDial: average(cur.dialDuration-last.dialDuration, cur.dials-last.dials),
+		AvgHold: average(cur.holdDuration-last.holdDuration, cur.returns-last.returns),
+	}
+	targetWait := a.TargetWait
+	if targetWait <= 0 {
+		targetWait = defaultTargetWait
+	}
+	step := a.Step
+	if step <= 0 {
+		step = 1
+	}
+
+	clamp := func(n int) int {
+		if a.MaxActive > 0 && n > a.MaxActive {
+			n = a.MaxActive
+		}
+		if n < a.MinActive {
+			n = a.MinActive
+		}
+		if n < 1 {
+			n = 1
+		}
+		return n
+	}
+	// 未设置上限时从Adaptive.MaxActive开始，也未设置时从当前连接数开始
+	base := p.MaxActive
+	if base <= 0 {
+		base = a.MaxActive
+		if base <= 0 {
+			base = p.active
+		}
+	}
+	base = clamp(base)
+
+	limit := base
+	switch {
+	case a.MaxLatency > 0 && (d.AvgDial > a.MaxLatency || d.AvgHold > a.MaxLatency):
+		limit = clamp(base - step)
+	case d.AvgWait > targetWait || cur.exhausted > last.exhausted:
+		limit = clamp(base + step)
+	}
+	if limit > base {
+		d.Action = AdaptiveGrow
+	} else if limit < base {
+		d.Action = AdaptiveShrink
+	}
+	d.Limit = limit
+	p.adaptive = d
+	changed := limit != p.MaxActive
+	p.mu.Unlock()
+
+	if changed {
+		p.SetMaxActive(limit)
+	}
+}
+
+// 平均耗时，n为0时返回0
+func average(total time.Duration, n int64) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+
+	return total / time.Duration(n)
+}
@@ -0,0 +1,122 @@
+package ignition
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveGrow(t *testing.T) {
+	p := newTestPool(1, 1)
+	p.Adaptive = &Adaptive{MinActive: 1, MaxActive: 2, TargetWait: time.Millisecond}
+	defer p.Close()
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = p.GetContext(ctx)
+	assert.Equal(t, ErrPoolTimeout, err)
+
+	p.adapt()
+	d := p.Stats().Adaptive
+	assert.Equal(t, AdaptiveGrow, d.Action)
+	assert.Equal(t, 2, d.Limit)
+	assert.True(t, d.AvgWait >= 20*time.Millisecond)
+	assert.Equal(t, 2, p.Stats().MaxActive)
+
+	// 不再等待时保持不变
+	pc2, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc2.Close())
+	p.adapt()
+	assert.Equal(t, AdaptiveHold, p.Stats().Adaptive.Action)
+
+	// 不超过上限
+	pc2, err = p.Get()
+	assert.Nil(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = p.GetContext(ctx)
+	assert.Equal(t, ErrPoolTimeout, err)
+	p.adapt()
+	assert.Equal(t, AdaptiveHold, p.Stats().Adaptive.Action)
+	assert.Equal(t, 2, p.Stats().MaxActive)
+	assert.Nil(t, pc.Close())
+	assert.Nil(t, pc2.Close())
+}
+
+func TestAdaptiveShrink(t *testing.T) {
+	p := newTestPool(3, 3)
+	p.Adaptive = &Adaptive{MinActive: 2, MaxActive: 4, MaxLatency: time.Millisecond}
+	defer p.Close()
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, pc.Close())
+
+	p.adapt()
+	d := p.Stats().Adaptive
+	assert.Equal(t, AdaptiveShrink, d.Action)
+	assert.Equal(t, 2, d.Limit)
+	assert.True(t, d.AvgHold >= 5*time.Millisecond)
+
+	// 不低于下限
+	pc, err = p.Get()
+	assert.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(t, pc.Close())
+	p.adapt()
+	assert.Equal(t, AdaptiveHold, p.Stats().Adaptive.Action)
+	assert.Equal(t, 2, p.Stats().MaxActive)
+}
+
+func TestAdaptiveExhausted(t *testing.T) {
+	p := newTestPool(1, 1)
+	p.Wait = false
+	p.Adaptive = &Adaptive{MaxActive: 5, Step: 2}
+	defer p.Close()
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	_, err = p.Get()
+	assert.Equal(t, ErrPoolExhausted, err)
+	assert.Equal(t, int64(1), p.Stats().Exhausted)
+
+	p.adapt()
+	assert.Equal(t, 3, p.Stats().MaxActive)
+	assert.Nil(t, pc.Close())
+}
+
+func TestAdaptiveUnlimited(t *testing.T) {
+	for _, c := range []struct {
+		adaptive *Adaptive
+		limit    int
+	}{
+		{&Adaptive{MinActive: 1, MaxActive: 8}, 8},
+		// 没有上限时从当前连接数开始
+		{&Adaptive{MinActive: 2}, 4},
+	} {
+		p := newTestPool(0, 4)
+		p.Adaptive = c.adaptive
+
+		var pcs []*PooledConn[*testConn]
+		for i := 0; i < 4; i++ {
+			pc, err := p.Get()
+			assert.Nil(t, err)
+			pcs = append(pcs, pc)
+		}
+
+		p.adapt()
+		d := p.Stats().Adaptive
+		assert.Equal(t, AdaptiveHold, d.Action)
+		assert.Equal(t, c.limit, d.Limit)
+		assert.Equal(t, c.limit, p.Stats().MaxActive)
+		for _, pc := range pcs {
+			assert.Nil(t, pc.Close())
+		}
+		assert.Nil(t, p.Close())
+	}
+}
@@ -0,0 +1,83 @@
+package ignition
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 比较单锁连接池与分片连接池的吞吐和尾延迟
+//
+//	go test -run '^$' -bench . -benchmem -cpu 1,4,16
+
+type getter interface {
+	GetContext(ctx context.Context) (*PooledConn[*testConn], error)
+	Close() error
+}
+
+const benchMaxActive = 64
+
+func newBenchPool() getter {
+	return newTestPool(benchMaxActive, benchMaxActive)
+}
+
+func newBenchShardedPool(shards int) func() getter {
+	return func() getter {
+		return newTestShardedPool(shards, benchMaxActive/shards, benchMaxActive/shards)
+	}
+}
+
+// 并发获取并归还连接，报告p50、p99和最大延迟
+func benchGetPut(b *testing.B, newPool func() getter) {
+	p := newPool()
+	defer p.Close()
+	ctx := context.Background()
+	var mu sync.Mutex
+	var latencies []time.Duration
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		local := make([]time.Duration, 0, 1024)
+		for pb.Next() {
+			start := time.Now()
+			pc, err := p.GetContext(ctx)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			local = append(local, time.Since(start))
+			pc.Close()
+		}
+		mu.Lock()
+		latencies = append(latencies, local...)
+		mu.Unlock()
+	})
+	b.StopTimer()
+
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	quantile := func(q float64) float64 {
+		return float64(latencies[int(q*float64(len(latencies)-1))].Nanoseconds())
+	}
+	b.ReportMetric(quantile(0.5), "p50-ns")
+	b.ReportMetric(quantile(0.99), "p99-ns")
+	b.ReportMetric(quantile(1), "max-ns")
+}
+
+func BenchmarkPoolGetPut(b *testing.B) {
+	benchGetPut(b, newBenchPool)
+}
+
+func BenchmarkShardedPoolGetPut(b *testing.B) {
+	for _, shards := range []int{4, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			benchGetPut(b, newBenchShardedPool(shards))
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package ignition
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	// 默认重试退避初始间隔
+	defaultDialBackoff = 100 * time.Millisecond
+	// 默认熔断持续时间
+	defaultBreakerCooldown = 5 * time.Second
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// 熔断中，新建连接被拒绝
+type BreakerOpenError struct {
+	PoolID string
+	// 熔断结束时间，之后允许一次探测
+	Until time.Time
+	// 最后一次新建连接的错误
+	Err error
+}
+
+func (e *BreakerOpenError) Error() string {
+	return fmt.Sprintf("connection pool %s: circuit breaker open until %s: %v",
+		e.PoolID, e.Until.Format(time.RFC3339), e.Err)
+}
+
+func (e *BreakerOpenError) Unwrap() error {
+	return e.Err
+}
+
+// 熔断器，由p.mu保护
+type breaker struct {
+	state    string
+	failures int       // 连续失败次数
+	until    time.Time // 熔断结束时间
+	lastErr  error
+}
+
+// 新建连接
+// 失败时按DialRetries重试，间隔指数退避并加入随机抖动
+// 熔断中直接返回*BreakerOpenError
+func (p *Pool[T]) dial(ctx context.Context) (T, error) {
+	var zero T
+	if err := p.breakerAllow(); err != nil {
+		return zero, err
+	}
+
+	backoff := p.DialBackoff
+	if backoff <= 0 {
+		backoff = defaultDialBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		c, err := p.Dial()
+		p.dialed(c, start, err)
+		if err == nil {
+			p.breakerDone(nil)
+			return c, nil
+		}
+		if attempt >= p.DialRetries {
+			p.breakerDone(err)
+			return zero, err
+		}
+
+		// equal jitter: [backoff/2, backoff)
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			p.breakerDone(err)
+			return zero, err
+		}
+		backoff *= 2
+		if p.DialMaxBackoff > 0 && backoff > p.DialMaxBackoff {
+			backoff = p.DialMaxBackoff
+		}
+	}
+}
+
+// 检查熔断器是否允许新建连接
+// 熔断时间结束后进入半开状态，只放行一次探测
+func (p *Pool[T]) breakerAllow() error {
+	if p.BreakerThreshold <= 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := &p.breaker
+	switch b.state {
+	case BreakerOpen:
+		if !time.Now().Before(b.until) {
+			// 熔断结束，放行一次探测
+			b.state = BreakerHalfOpen
+			return nil
+		}
+	case BreakerHalfOpen:
+		// 探测进行中
+	default:
+		return nil
+	}
+	p.stats.breakerRejects++
+
+	return &BreakerOpenError{PoolID: p.ID, Until: b.until, Err: b.lastErr}
+}
+
+// 记录新建连接的结果
+func (p *Pool[T]) breakerDone(err error) {
+	if p.BreakerThreshold <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := &p.breaker
+	if err == nil {
+		b.state = BreakerClosed
+		b.failures = 0
+		b.lastErr = nil
+		return
+	}
+	b.failures++
+	b.lastErr = err
+	if b.state == BreakerHalfOpen || b.failures >= p.BreakerThreshold {
+		cooldown := p.BreakerCooldown
+		if cooldown <= 0 {
+			cooldown = defaultBreakerCooldown
+		}
+		b.state = BreakerOpen
+		b.until = time.Now().Add(cooldown)
+	}
+}
+
+// 熔断器状态
+// 调用时须持有p.mu
+func (p *Pool[T]) breakerState() string {
+	if p.breaker.state == "" {
+		return BreakerClosed
+	}
+
+	return p.breaker.state
+}
@@ -0,0 +1,79 @@
+package ignition
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPoolDialRetry(t *testing.T) {
+	failures := 2
+	p := &Pool[*testConn]{
+		MaxActive:   1,
+		MaxIdle:     1,
+		DialRetries: 2,
+		DialBackoff: time.Millisecond,
+		Dial: func() (*testConn, error) {
+			if failures > 0 {
+				failures--
+				return nil, errors.New("dial failed")
+			}
+			return &testConn{}, nil
+		},
+	}
+	defer p.Close()
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, int64(0), p.Stats().DialFailures)
+}
+
+func TestPoolBreaker(t *testing.T) {
+	dialErr := errors.New("dial failed")
+	down := true
+	dials := 0
+	p := &Pool[*testConn]{
+		MaxActive:        1,
+		MaxIdle:          1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  30 * time.Millisecond,
+		Dial: func() (*testConn, error) {
+			dials++
+			if down {
+				return nil, dialErr
+			}
+			return &testConn{}, nil
+		},
+	}
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := p.Get()
+		assert.Equal(t, dialErr, err)
+	}
+	_, err := p.Get()
+	boe, ok := err.(*BreakerOpenError)
+	assert.True(t, ok)
+	assert.True(t, errors.Is(boe, dialErr))
+	assert.Equal(t, 2, dials)
+	assert.Equal(t, BreakerOpen, p.Stats().BreakerState)
+	assert.Equal(t, int64(2), p.Stats().DialFailures)
+
+	// a failed probe reopens the breaker
+	time.Sleep(40 * time.Millisecond)
+	_, err = p.Get()
+	assert.Equal(t, dialErr, err)
+	_, err = p.Get()
+	assert.IsType(t, &BreakerOpenError{}, err)
+
+	// a successful probe closes it
+	down = false
+	time.Sleep(40 * time.Millisecond)
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, BreakerClosed, p.Stats().BreakerState)
+	assert.Equal(t, int64(2), p.Stats().BreakerRejects)
+}
@@ -0,0 +1,171 @@
+package ignition
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// 从库负载均衡策略
+type Balance int
+
+const (
+	// 轮询
+	RoundRobin Balance = iota
+	// 选择使用中连接最少的从库
+	LeastActive
+)
+
+const (
+	// 默认剔除阈值
+	defaultEjectThreshold = 1
+	// 默认剔除时长
+	defaultEjectDuration = 30 * time.Second
+)
+
+// 读写分离连接池
+// 每个节点一个连接池，写操作使用主库，读操作在从库间负载均衡
+// 从库新建连接失败时暂时剔除，没有可用从库或从库连接数已满时读主库
+type ClusterPool[T Conn] struct {
+	Primary  *Pool[T]
+	Replicas []*Pool[T]
+	// 从库负载均衡策略
+	Balance Balance
+	// 从库连续新建连接失败达到该次数时剔除，默认1
+	EjectThreshold int
+	// 剔除时长，到期后重新参与负载均衡，默认30s
+	EjectDuration time.Duration
+
+	mu     sync.Mutex
+	next   int                         // 轮询位置
+	health map[*Pool[T]]*replicaHealth // 从库健康状态
+}
+
+// 从库健康状态
+type replicaHealth struct {
+	failures     int       // 连续失败次数
+	ejectedUntil time.Time // 剔除结束时间
+}
+
+// 从主库获取连接
+func (c *ClusterPool[T]) GetWrite(ctx context.Context) (*PooledConn[T], error) {
+	return c.Primary.GetContext(ctx)
+}
+
+// 从从库获取连接
+// 依次尝试可用的从库，不等待名额，都不可用或连接数已满时使用主库
+func (c *ClusterPool[T]) GetRead(ctx context.Context) (*PooledConn[T], error) {
+	replicas := c.replicas()
+	// 调用栈只记录一次，供所有从库使用
+	var stack []byte
+	for _, p := range replicas {
+		if p.LeakThreshold > 0 {
+			stack = debug.Stack()
+			break
+		}
+	}
+	for _, p := range replicas {
+		pc, err := p.tryGet(ctx, stack)
+		if err == nil {
+			c.report(p, nil)
+			return pc, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		switch err {
+		case ErrPoolExhausted, ErrPoolClosed:
+			// 连接池本身不可用，不剔除，尝试下一个从库
+		default:
+			c.report(p, err)
+		}
+	}
+
+	return c.Primary.GetContext(ctx)
+}
+
+// 关闭所有连接池
+func (c *ClusterPool[T]) Close() error {
+	err := c.Primary.Close()
+	for _, p := range c.Replicas {
+		if e := p.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// 按负载均衡策略排序的可用从库
+func (c *ClusterPool[T]) replicas() []*Pool[T] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	available := make([]*Pool[T], 0, len(c.Replicas))
+	for _, p := range c.Replicas {
+		if h := c.health[p]; h != nil && now.Before(h.ejectedUntil) {
+			continue
+		}
+		available = append(available, p)
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	switch c.Balance {
+	case LeastActive:
+		load := make(map[*Pool[T]]int, len(available))
+		for _, p := range available {
+			s := p.Stats()
+			load[p] = s.InUse + s.Waiting
+		}
+		// 插入排序，从库数量通常很少
+		for i := 1; i < len(available); i++ {
+			for j := i; j > 0 && load[available[j]] < load[available[j-1]]; j-- {
+				available[j], available[j-1] = available[j-1], available[j]
+			}
+		}
+	default:
+		start := c.next % len(available)
+		c.next++
+		available = append(available[start:], available[:start]...)
+	}
+
+	return available
+}
+
+// 记录从库获取连接的结果
+// 连续失败达到EjectThreshold时剔除该从库
+func (c *ClusterPool[T]) report(p *Pool[T], err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.health == nil {
+		c.health = map[*Pool[T]]*replicaHealth{}
+	}
+	h := c.health[p]
+	if h == nil {
+		h = &replicaHealth{}
+		c.health[p] = h
+	}
+	if err == nil {
+		h.failures = 0
+		return
+	}
+
+	h.failures++
+	threshold := c.EjectThreshold
+	if threshold <= 0 {
+		threshold = defaultEjectThreshold
+	}
+	if h.failures >= threshold {
+		d := c.EjectDuration
+		if d <= 0 {
+			d = defaultEjectDuration
+		}
+		h.failures = 0
+		h.ejectedUntil = time.Now().Add(d)
+	}
+}
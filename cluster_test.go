@@ -0,0 +1,141 @@
+package ignition
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newClusterTestPool(id string, fail *bool) *Pool[*testConn] {
+	return &Pool[*testConn]{
+		ID:        id,
+		MaxActive: 2,
+		MaxIdle:   2,
+		Dial: func() (*testConn, error) {
+			if fail != nil && *fail {
+				return nil, errors.New(id + " is down")
+			}
+			return &testConn{}, nil
+		},
+	}
+}
+
+func TestClusterPool(t *testing.T) {
+	down := false
+	primary := newClusterTestPool("primary", nil)
+	r1 := newClusterTestPool("r1", &down)
+	r2 := newClusterTestPool("r2", nil)
+	c := &ClusterPool[*testConn]{
+		Primary:       primary,
+		Replicas:      []*Pool[*testConn]{r1, r2},
+		EjectDuration: 30 * time.Millisecond,
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	pc, err := c.GetWrite(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, int64(1), primary.Stats().Dials)
+
+	// round robin across replicas
+	for i := 0; i < 4; i++ {
+		pc, err = c.GetRead(ctx)
+		assert.Nil(t, err)
+		assert.Nil(t, pc.Close())
+	}
+	assert.Equal(t, int64(2), r1.Stats().Hits+r1.Stats().Dials)
+	assert.Equal(t, int64(2), r2.Stats().Hits+r2.Stats().Dials)
+
+	// a replica failing to dial is ejected
+	r1.SetMaxIdle(0)
+	down = true
+	for i := 0; i < 4; i++ {
+		pc, err = c.GetRead(ctx)
+		assert.Nil(t, err)
+		assert.Nil(t, pc.Close())
+	}
+	assert.Equal(t, int64(1), r1.Stats().DialFailures)
+
+	// all replicas unavailable: read from primary
+	r2.Close()
+	pc, err = c.GetRead(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, int64(2), primary.Stats().Hits+primary.Stats().Dials)
+
+	// ejected replica comes back after EjectDuration
+	down = false
+	time.Sleep(40 * time.Millisecond)
+	pc, err = c.GetRead(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, int64(2), r1.Stats().Dials)
+}
+
+func TestClusterPoolLeastActive(t *testing.T) {
+	r1 := newClusterTestPool("r1", nil)
+	r2 := newClusterTestPool("r2", nil)
+	c := &ClusterPool[*testConn]{
+		Primary:  newClusterTestPool("primary", nil),
+		Replicas: []*Pool[*testConn]{r1, r2},
+		Balance:  LeastActive,
+	}
+	defer c.Close()
+
+	pc1, err := c.GetRead(context.Background())
+	assert.Nil(t, err)
+	pc2, err := c.GetRead(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r1.Stats().InUse)
+	assert.Equal(t, 1, r2.Stats().InUse)
+	assert.Nil(t, pc1.Close())
+	assert.Nil(t, pc2.Close())
+}
+
+func TestClusterPoolSaturatedReplicas(t *testing.T) {
+	primary := newClusterTestPool("primary", nil)
+	r1 := newClusterTestPool("r1", nil)
+	r2 := newClusterTestPool("r2", nil)
+	r1.MaxActive, r2.MaxActive = 1, 1
+	r1.Wait, r2.Wait = true, true
+	c := &ClusterPool[*testConn]{
+		Primary:  primary,
+		Replicas: []*Pool[*testConn]{r1, r2},
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	pc1, err := c.GetRead(ctx)
+	assert.Nil(t, err)
+	pc2, err := c.GetRead(ctx)
+	assert.Nil(t, err)
+
+	// both replicas are saturated: read from primary without waiting
+	got := make(chan error, 1)
+	go func() {
+		pc, err := c.GetRead(ctx)
+		if err == nil {
+			err = pc.Close()
+		}
+		got <- err
+	}()
+	select {
+	case err = <-got:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("GetRead blocked on saturated replicas")
+	}
+	assert.Equal(t, int64(1), primary.Stats().Dials)
+	assert.Equal(t, 0, r1.Stats().Waiting+r2.Stats().Waiting)
+
+	// saturated replicas are not ejected
+	assert.Nil(t, pc1.Close())
+	pc, err := c.GetRead(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+	assert.Nil(t, pc2.Close())
+	assert.Equal(t, int64(1), primary.Stats().Dials+primary.Stats().Hits)
+}
@@ -1,48 +1,208 @@
 package ignition
 
 import (
-	"gopkg.in/yaml.v2"
+	"errors"
 	"io/ioutil"
+	"reflect"
 	"sync"
 
 	"os"
 	"time"
 )
 
+// Default interval of polling watched files for changes
+const defaultPollInterval = time.Second
+
 type Config struct {
-	mut          sync.Mutex
+	// Interval of polling watched files for changes, 1s by default
+	PollInterval time.Duration
+	// Prefix of environment variables overriding loaded values, e.g. APP for APP_DBHOST.
+	// Empty to disable
+	EnvPrefix string
+	// Decoder of loaded files, nil to choose by the file extension:
+	// .yml and .yaml for YAML, .json, .toml, .ini and .env for dotenv.
+	// Files with other extensions are decoded as YAML
+	Decoder Decoder
+
+	mut          sync.RWMutex
 	fileLoadedAt map[string]int64
 }
 
 // Check if the configuration file need reload.
-// If the file have been loaded and be modified since then, return true
+// If the file have not been loaded or been modified since then, return true
 func (c *Config) NeedReload(file string) bool {
-	if c.fileLoadedAt == nil {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	loadedAt, ok := c.fileLoadedAt[file]
+	if !ok {
 		return true
 	}
-	if loadedAt, ok := c.fileLoadedAt[file]; ok {
-		modAt, _ := getFileModAt(file)
-		return modAt >= loadedAt
-	}
+	modAt, err := getFileModAt(file)
 
-	return true
+	return err != nil || modAt != loadedAt
 }
 
-// Load YAML file into configuration variable
+// Load configuration file into configuration variable.
+// ${VAR} and ${VAR:-default} in the file are replaced with environment variables,
+// then values are overridden by environment variables with EnvPrefix if set
 func (c *Config) Load(file string, conf interface{}) error {
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
+	modAt, err := c.decodeFile(file, conf)
+	if modAt != 0 {
+		c.loaded(file, modAt)
+	}
+
+	return err
+}
+
+// Run fn with the read lock held, so watched configuration is not swapped during fn
+func (c *Config) Read(fn func()) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	fn()
+}
+
+// Watch the configuration file and reload it when modified.
+// The file is loaded first if it has not been loaded.
+// Each reload parses the file into a fresh value, which replaces conf only if parsing succeeds,
+// then onChange callbacks are called with copies of the old and the new value.
+// conf must be a pointer, read it via Config.Read while watching.
+func (c *Config) Watch(file string, conf interface{}, onChange ...func(old, new interface{})) (*Watcher, error) {
+	rv := reflect.ValueOf(conf)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, errors.New("config: Watch requires a non-nil pointer")
+	}
+	if c.NeedReload(file) {
+		if err := c.Load(file, conf); err != nil {
+			return nil, err
+		}
+	}
+
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	w := &Watcher{stop: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(w.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				if c.NeedReload(file) {
+					w.setErr(c.reload(file, rv, onChange))
+				}
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// Parse the file into a fresh value and swap it in on success
+func (c *Config) reload(file string, rv reflect.Value, onChange []func(old, new interface{})) error {
+	fresh := reflect.New(rv.Type().Elem())
+	modAt, err := c.decodeFile(file, fresh.Interface())
+	if err != nil {
+		if modAt != 0 {
+			// do not retry until the file is modified again
+			c.mut.Lock()
+			c.loaded(file, modAt)
+			c.mut.Unlock()
+		}
+		return err
+	}
+
+	old := reflect.New(rv.Type().Elem())
+	c.mut.Lock()
+	old.Elem().Set(rv.Elem())
+	rv.Elem().Set(fresh.Elem())
+	c.loaded(file, modAt)
+	c.mut.Unlock()
+
+	for _, f := range onChange {
+		f(old.Interface(), fresh.Interface())
+	}
+
+	return nil
+}
+
+// Record the modification time of the loaded file, must be called with c.mut held
+func (c *Config) loaded(file string, modAt int64) {
 	if c.fileLoadedAt == nil {
 		c.fileLoadedAt = map[string]int64{}
 	}
+	c.fileLoadedAt[file] = modAt
+}
+
+// Watcher of a configuration file
+type Watcher struct {
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+	mut      sync.Mutex
+	err      error
+}
+
+// Stop watching and wait for the polling goroutine to exit
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.stopped
+}
+
+// Error of the latest reload, nil if it succeeded
+func (w *Watcher) Err() error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	return w.err
+}
+
+func (w *Watcher) setErr(err error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	w.err = err
+}
 
+// Read and parse the file into conf.
+// Returns the modification time of the file read, or 0 if it could not be read
+func (c *Config) decodeFile(file string, conf interface{}) (int64, error) {
+	// stat before reading so that a later modification is not missed
+	modAt, err := getFileModAt(file)
+	if err != nil {
+		return 0, err
+	}
 	content, err := ioutil.ReadFile(file)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	c.fileLoadedAt[file] = time.Now().Unix()
-	return yaml.Unmarshal(content, conf)
+
+	expanded, err := expandEnv(string(content))
+	if err != nil {
+		return modAt, err
+	}
+	decoder := c.Decoder
+	if decoder == nil {
+		decoder = decoderFor(file)
+	}
+	if err := decoder.Decode([]byte(expanded), conf); err != nil {
+		return modAt, err
+	}
+	if c.EnvPrefix != "" {
+		return modAt, applyEnv(c.EnvPrefix, conf)
+	}
+
+	return modAt, nil
 }
 
 func getFileModAt(file string) (int64, error) {
@@ -51,5 +211,5 @@ func getFileModAt(file string) (int64, error) {
 		return 0, err
 	}
 
-	return fi.ModTime().Unix(), nil
+	return fi.ModTime().UnixNano(), nil
 }
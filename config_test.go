@@ -3,6 +3,7 @@ package ignition
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
@@ -40,3 +41,53 @@ func TestConfig(t *testing.T) {
 	// modify yml file in time
 	assert.True(t, conf.NeedReload(filePath))
 }
+
+type watchConf struct {
+	Locale string `yaml:"locale"`
+	Port   int    `yaml:"port"`
+}
+
+func TestConfigWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "conf.yml")
+	write := func(content string, modAt time.Time) {
+		assert.Nil(t, os.WriteFile(file, []byte(content), 0644))
+		assert.Nil(t, os.Chtimes(file, modAt, modAt))
+	}
+	now := time.Now()
+	write("locale: en\nport: 80\n", now)
+
+	conf := Config{PollInterval: 10 * time.Millisecond}
+	myconf := &watchConf{}
+	changes := make(chan [2]*watchConf, 1)
+	w, err := conf.Watch(file, myconf, func(old, new interface{}) {
+		changes <- [2]*watchConf{old.(*watchConf), new.(*watchConf)}
+	})
+	assert.Nil(t, err)
+	defer w.Stop()
+	assert.Equal(t, watchConf{Locale: "en", Port: 80}, *myconf)
+	assert.False(t, conf.NeedReload(file))
+
+	// removed keys are reset by reloading into a fresh value
+	write("locale: zh_cn\n", now.Add(time.Second))
+	select {
+	case c := <-changes:
+		assert.Equal(t, watchConf{Locale: "en", Port: 80}, *c[0])
+		assert.Equal(t, watchConf{Locale: "zh_cn"}, *c[1])
+	case <-time.After(time.Second):
+		t.Fatal("change not detected")
+	}
+	conf.Read(func() {
+		assert.Equal(t, watchConf{Locale: "zh_cn"}, *myconf)
+	})
+
+	// invalid files keep the current configuration
+	write("locale: [\n", now.Add(2*time.Second))
+	assert.Eventually(t, func() bool { return w.Err() != nil }, time.Second, 10*time.Millisecond)
+	conf.Read(func() {
+		assert.Equal(t, watchConf{Locale: "zh_cn"}, *myconf)
+	})
+	assert.Len(t, changes, 0)
+
+	_, err = conf.Watch(file, watchConf{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,380 @@
+package ignition
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Decoder parses the content of a configuration file into conf
+type Decoder interface {
+	Decode(content []byte, conf interface{}) error
+}
+
+// DecoderFunc adapts a function to Decoder
+type DecoderFunc func(content []byte, conf interface{}) error
+
+func (f DecoderFunc) Decode(content []byte, conf interface{}) error {
+	return f(content, conf)
+}
+
+// Built-in decoders
+var (
+	YAMLDecoder   Decoder = DecoderFunc(yaml.Unmarshal)
+	JSONDecoder   Decoder = DecoderFunc(decodeJSON)
+	TOMLDecoder   Decoder = DecoderFunc(toml.Unmarshal)
+	INIDecoder    Decoder = DecoderFunc(decodeINI)
+	DotenvDecoder Decoder = DecoderFunc(decodeDotenv)
+)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]Decoder{
+		".yml":  YAMLDecoder,
+		".yaml": YAMLDecoder,
+		".json": JSONDecoder,
+		".toml": TOMLDecoder,
+		".ini":  INIDecoder,
+		".env":  DotenvDecoder,
+	}
+)
+
+// Register the decoder of files with the extension, such as ".hcl".
+// A decoder registered with the same extension is replaced
+func RegisterDecoder(ext string, d Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	decoders[strings.ToLower(ext)] = d
+}
+
+// Decoder of the file, chosen by the file extension.
+// Files with unknown extensions are decoded as YAML
+func decoderFor(file string) Decoder {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	if d, ok := decoders[strings.ToLower(filepath.Ext(file))]; ok {
+		return d
+	}
+
+	return YAMLDecoder
+}
+
+// Decode JSON content.
+// Unlike encoding/json, keys are matched like the other formats and durations may be strings such as "5m"
+func decodeJSON(content []byte, conf interface{}) error {
+	rv := reflect.ValueOf(conf)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("config: decode requires a non-nil pointer")
+	}
+
+	var data interface{}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return err
+	}
+
+	return assignJSON(rv.Elem(), data, "")
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Assign decoded JSON data to v, path is used in errors
+func assignJSON(v reflect.Value, data interface{}, path string) error {
+	if data == nil {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assignJSON(v.Elem(), data, path)
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(jsonUnmarshalerType) {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(raw)
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(plainJSON(data)))
+		return nil
+	}
+
+	var err error
+	switch d := data.(type) {
+	case map[string]interface{}:
+		switch v.Kind() {
+		case reflect.Struct:
+			for key, val := range d {
+				if f, ok := findField(v, key); ok {
+					if err := assignJSON(f, val, path+"."+key); err != nil {
+						return err
+					}
+				}
+			}
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return fmt.Errorf("json: %s: unsupported map key type %s", path, v.Type().Key())
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			for key, val := range d {
+				k := reflect.ValueOf(key).Convert(v.Type().Key())
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if old := v.MapIndex(k); old.IsValid() {
+					elem.Set(old)
+				}
+				if err := assignJSON(elem, val, path+"."+key); err != nil {
+					return err
+				}
+				v.SetMapIndex(k, elem)
+			}
+		default:
+			err = fmt.Errorf("cannot decode object into %s", v.Type())
+		}
+	case []interface{}:
+		if v.Kind() != reflect.Slice {
+			err = fmt.Errorf("cannot decode array into %s", v.Type())
+			break
+		}
+		slice := reflect.MakeSlice(v.Type(), len(d), len(d))
+		for i, val := range d {
+			if err := assignJSON(slice.Index(i), val, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case json.Number:
+		if v.Type() == durationType {
+			// numeric durations are nanoseconds, as in encoding/json
+			var n int64
+			if n, err = d.Int64(); err == nil {
+				v.SetInt(n)
+			}
+			break
+		}
+		err = setString(v, d.String())
+	case bool:
+		if v.Kind() != reflect.Bool {
+			err = fmt.Errorf("cannot decode bool into %s", v.Type())
+			break
+		}
+		v.SetBool(d)
+	case string:
+		err = setString(v, d)
+	}
+	if err != nil {
+		return fmt.Errorf("json: %s: %v", strings.TrimPrefix(path, "."), err)
+	}
+
+	return nil
+}
+
+// Convert json.Number in decoded data to float64, as encoding/json does for interface values
+func plainJSON(data interface{}) interface{} {
+	switch d := data.(type) {
+	case json.Number:
+		f, _ := d.Float64()
+		return f
+	case map[string]interface{}:
+		for k, v := range d {
+			d[k] = plainJSON(v)
+		}
+	case []interface{}:
+		for i, v := range d {
+			d[i] = plainJSON(v)
+		}
+	}
+
+	return data
+}
+
+// Decode INI content.
+// Keys before any section are top-level keys, keys in [a.b] are nested in a and b.
+// Lines starting with ; or # are comments, values may be quoted.
+func decodeINI(content []byte, conf interface{}) error {
+	rv := reflect.ValueOf(conf)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("config: decode requires a non-nil pointer")
+	}
+
+	var section []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return fmt.Errorf("ini: line %d: invalid section %q", n, line)
+			}
+			section = strings.Split(strings.TrimSpace(line[1:len(line)-1]), ".")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("ini: line %d: missing = in %q", n, line)
+		}
+		path := append(append([]string(nil), section...), strings.TrimSpace(key))
+		if err := setPath(rv.Elem(), path, unquote(strings.TrimSpace(value))); err != nil {
+			return fmt.Errorf("ini: line %d: %v", n, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Decode dotenv content.
+// Variables are mapped to keys like EnvPrefix overrides without the prefix, e.g. POOLS_PRIMARY_HOST.
+// Map entries are created with lowercased keys, such as primary for POOLS_PRIMARY_HOST.
+// Lines may start with export, values may be quoted, # starts a comment outside quotes.
+func decodeDotenv(content []byte, conf interface{}) error {
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("dotenv: line %d: missing = in %q", n, line)
+		}
+		value = strings.TrimSpace(value)
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		vars[strings.TrimSpace(key)] = unquote(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return overlay(conf, "", varSource{
+		lookup: func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		},
+		names: names,
+	})
+}
+
+// Remove surrounding quotes.
+// Double quoted values support \n, \t, \" and \\ escapes, single quoted values are literal
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != s[len(s)-1] {
+		return s
+	}
+	switch s[0] {
+	case '\'':
+		return s[1 : len(s)-1]
+	case '"':
+		return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(s[1 : len(s)-1])
+	}
+
+	return s
+}
+
+// Set the value at path, creating map entries and pointers as needed.
+// Keys without a matching field are ignored
+func setPath(v reflect.Value, path []string, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setPath(v.Elem(), path, s)
+	}
+	if len(path) == 0 {
+		return setString(v, s)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if f, ok := findField(v, path[0]); ok {
+			return setPath(f, path[1:], s)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if old := v.MapIndex(key); old.IsValid() {
+			elem.Set(old)
+		}
+		if err := setPath(elem, path[1:], s); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		m, ok := v.Interface().(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+		}
+		mv := reflect.ValueOf(m)
+		if err := setPath(mv, path, s); err != nil {
+			return err
+		}
+		v.Set(mv)
+	}
+
+	return nil
+}
+
+// Find the struct field by its key case-insensitively, looking into inlined structs
+func findField(v reflect.Value, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, inline := fieldKey(f)
+		if inline {
+			fv := reflect.Indirect(v.Field(i))
+			if fv.Kind() != reflect.Struct {
+				// nil pointers are not inlined
+				continue
+			}
+			if found, ok := findField(fv, key); ok {
+				return found, true
+			}
+			continue
+		}
+		if name != "-" && strings.EqualFold(name, key) {
+			return v.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
@@ -0,0 +1,127 @@
+package ignition
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type decodeConf struct {
+	Locale  string                `yaml:"locale" json:"locale" toml:"locale"`
+	Debug   bool                  `yaml:"debug" json:"debug" toml:"debug"`
+	Timeout time.Duration         `yaml:"timeout" json:"timeout" toml:"timeout"`
+	Pools   map[string]PoolConfig `yaml:"pools" json:"pools" toml:"pools"`
+}
+
+func loadString(t *testing.T, conf *Config, name, content string) (*decodeConf, error) {
+	file := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(file, []byte(content), 0644))
+	c := &decodeConf{}
+	return c, conf.Load(file, c)
+}
+
+func TestConfigDecoders(t *testing.T) {
+	expected := decodeConf{
+		Locale:  "zh_cn",
+		Debug:   true,
+		Timeout: 5 * time.Second,
+		Pools: map[string]PoolConfig{"primary": {
+			Driver:      "postgres",
+			Host:        "127.0.0.1",
+			Port:        5432,
+			MaxActive:   10,
+			IdleTimeout: 5 * time.Minute,
+			Options:     map[string]string{"sslmode": "disable"},
+		}},
+	}
+	files := map[string]string{
+		"conf.yml": `locale: zh_cn
+debug: true
+timeout: 5s
+pools:
+  primary:
+    driver: postgres
+    host: 127.0.0.1
+    port: 5432
+    max_active: 10
+    idle_timeout: 5m
+    options:
+      sslmode: disable
+`,
+		"conf.json": `{"locale": "zh_cn", "debug": true, "timeout": "5s",
+	"pools": {"primary": {"driver": "postgres", "host": "127.0.0.1", "port": 5432,
+		"max_active": 10, "idle_timeout": "5m", "options": {"sslmode": "disable"}}}}`,
+		"conf.toml": `locale = "zh_cn"
+debug = true
+timeout = "5s"
+[pools.primary]
+driver = "postgres"
+host = "127.0.0.1"
+port = 5432
+max_active = 10
+idle_timeout = "5m"
+[pools.primary.options]
+sslmode = "disable"
+`,
+		"conf.ini": `; comment
+locale = "zh_cn"
+debug = true
+timeout = 5s
+
+[pools.primary]
+driver = postgres
+host = 127.0.0.1
+port = 5432
+max_active = 10
+idle_timeout = 5m
+
+[pools.primary.options]
+sslmode = disable
+`,
+		".env": `# comment
+export LOCALE='zh_cn'
+DEBUG=true # inline
+TIMEOUT="5s"
+POOLS_PRIMARY_DRIVER=postgres
+POOLS_PRIMARY_HOST=127.0.0.1
+POOLS_PRIMARY_PORT=5432
+POOLS_PRIMARY_MAX_ACTIVE=10
+POOLS_PRIMARY_IDLE_TIMEOUT=5m
+POOLS_PRIMARY_OPTIONS_SSLMODE=disable
+`,
+	}
+	for name, content := range files {
+		c, err := loadString(t, &Config{}, name, content)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, *c, name)
+	}
+
+	// numeric durations in JSON are nanoseconds
+	_, err := loadString(t, &Config{}, "conf.json", `{"timeout": 1000, "pools": {"primary": {"port": "x"}}}`)
+	assert.Error(t, err)
+	c, err := loadString(t, &Config{}, "conf.json", `{"timeout": 1000}`)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Microsecond, c.Timeout)
+
+	_, err = loadString(t, &Config{}, "conf.ini", "[pools.primary]\nport = x\n")
+	assert.Error(t, err)
+	_, err = loadString(t, &Config{}, "conf.ini", "locale\n")
+	assert.Error(t, err)
+}
+
+func TestConfigExplicitDecoder(t *testing.T) {
+	conf := &Config{Decoder: JSONDecoder}
+	c, err := loadString(t, conf, "conf.yml", `{"locale": "en"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "en", c.Locale)
+
+	RegisterDecoder(".upper", DecoderFunc(func(content []byte, conf interface{}) error {
+		return YAMLDecoder.Decode([]byte(strings.ToLower(string(content))), conf)
+	}))
+	c, err = loadString(t, &Config{}, "conf.UPPER", "LOCALE: EN")
+	assert.Nil(t, err)
+	assert.Equal(t, "en", c.Locale)
+}
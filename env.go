@@ -0,0 +1,326 @@
+package ignition
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Replace ${VAR} and ${VAR:-default} with environment variables.
+// The default is used when VAR is unset or empty, and $$ is an escaped $.
+// Substitution is textual, so quote values that may contain YAML syntax.
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("config: unterminated ${ at offset %d", i)
+			}
+			name, def, hasDef := strings.Cut(s[i+2:i+2+end], ":-")
+			if name == "" {
+				return "", fmt.Errorf("config: empty variable name at offset %d", i)
+			}
+			v, ok := os.LookupEnv(name)
+			if !ok || (hasDef && v == "") {
+				v = def
+			}
+			b.WriteString(v)
+			i += 2 + end
+		default:
+			b.WriteByte('$')
+		}
+	}
+
+	return b.String(), nil
+}
+
+// Override fields of conf with environment variables named by prefix and the field keys.
+// Keys are taken from yaml, json, toml or ini tags or lowercased field names, nested keys are joined with _ and uppercased,
+// e.g. APP_DBHOST for dbhost and APP_POOLS_PRIMARY_HOST for pools.primary.host.
+// Map entries are overridden only if they exist in the file.
+func applyEnv(prefix string, conf interface{}) error {
+	return overlay(conf, strings.TrimSuffix(prefix, "_"), varSource{lookup: os.LookupEnv})
+}
+
+// Variables overriding configuration values
+type varSource struct {
+	lookup func(name string) (string, bool)
+	// Names of all variables, used to create map entries. Nil to override existing entries only
+	names []string
+}
+
+// Override fields of conf with variables from src
+func overlay(conf interface{}, prefix string, src varSource) error {
+	rv := reflect.ValueOf(conf)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("config: decode requires a non-nil pointer")
+	}
+
+	return overlayEnv(rv.Elem(), prefix, src)
+}
+
+func overlayEnv(v reflect.Value, name string, src varSource) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return overlayEnv(v.Elem(), name, src)
+		}
+		if v.Type().Elem().Kind() == reflect.Struct {
+			return nil
+		}
+		s, ok := src.lookup(name)
+		if !ok {
+			return nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		if err := setString(elem.Elem(), s); err != nil {
+			return fmt.Errorf("config: %s: %v", name, err)
+		}
+		v.Set(elem)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			key, inline := fieldKey(f)
+			if key == "-" {
+				continue
+			}
+			fieldName := name
+			if !inline {
+				fieldName = joinEnvName(name, key)
+			}
+			if err := overlayEnv(v.Field(i), fieldName, src); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		keys := v.MapKeys()
+		existing := map[string]bool{}
+		for _, k := range keys {
+			existing[envName(k.String())] = true
+		}
+		for _, key := range mapKeys(v.Type().Elem(), name, src.names) {
+			if !existing[envName(key)] {
+				existing[envName(key)] = true
+				keys = append(keys, reflect.ValueOf(key).Convert(v.Type().Key()))
+			}
+		}
+		if len(keys) > 0 && v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, k := range keys {
+			// map values are not addressable, override a copy and store it back
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if old := v.MapIndex(k); old.IsValid() {
+				elem.Set(old)
+			}
+			if err := overlayEnv(elem, joinEnvName(name, k.String()), src); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, elem)
+		}
+	default:
+		s, ok := src.lookup(name)
+		if !ok {
+			return nil
+		}
+		if err := setString(v, s); err != nil {
+			return fmt.Errorf("config: %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Lowercased keys of map entries named by variables under name.
+// For struct values the key is the shortest prefix followed by a field name,
+// e.g. primary for POOLS_PRIMARY_MAX_ACTIVE under POOLS
+func mapKeys(elem reflect.Type, name string, names []string) []string {
+	prefix := ""
+	if name != "" {
+		prefix = name + "_"
+	}
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	var keys []string
+	for _, n := range names {
+		if !strings.HasPrefix(n, prefix) || len(n) == len(prefix) {
+			continue
+		}
+		rest := n[len(prefix):]
+		if elem.Kind() != reflect.Struct {
+			keys = append(keys, strings.ToLower(rest))
+			continue
+		}
+		for i := strings.IndexByte(rest, '_'); i > 0; {
+			if matchesField(elem, rest[i+1:]) {
+				keys = append(keys, strings.ToLower(rest[:i]))
+				break
+			}
+			j := strings.IndexByte(rest[i+1:], '_')
+			if j < 0 {
+				break
+			}
+			i += j + 1
+		}
+	}
+
+	return keys
+}
+
+// Whether the variable name, relative to the struct, names one of its fields
+func matchesField(t reflect.Type, name string) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		key, inline := fieldKey(f)
+		if inline {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && matchesField(ft, name) {
+				return true
+			}
+			continue
+		}
+		if key == "-" {
+			continue
+		}
+		if fn := envName(key); name == fn || strings.HasPrefix(name, fn+"_") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Struct tags naming configuration keys, in order of precedence
+var keyTags = []string{"yaml", "json", "toml", "ini"}
+
+// Key of the struct field and whether it is inlined
+func fieldKey(f reflect.StructField) (string, bool) {
+	for _, name := range keyTags {
+		tag, ok := f.Tag.Lookup(name)
+		if !ok {
+			continue
+		}
+		key, opts, _ := strings.Cut(tag, ",")
+		inline := strings.Contains(","+opts+",", ",inline,")
+		if key != "" || inline {
+			return key, inline
+		}
+	}
+
+	return strings.ToLower(f.Name), false
+}
+
+// Append the key to the variable name
+func joinEnvName(name, key string) string {
+	if name == "" {
+		return envName(key)
+	}
+
+	return name + "_" + envName(key)
+}
+
+// Uppercase the key and replace characters not allowed in environment variable names with _
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
+
+// Set a scalar or slice value from its string form, slice elements are separated by commas
+func setString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var parts []string
+		if s != "" {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setString(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(s))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package ignition
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("IGNITION_TEST_HOST", "db.local")
+	t.Setenv("IGNITION_TEST_EMPTY", "")
+
+	s, err := expandEnv("host: ${IGNITION_TEST_HOST}\nport: ${IGNITION_TEST_PORT:-5432}\n" +
+		"user: ${IGNITION_TEST_EMPTY:-root}\nname: ${IGNITION_TEST_EMPTY}\npassword: pa$$word$x\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "host: db.local\nport: 5432\nuser: root\nname: \npassword: pa$word$x\n", s)
+
+	_, err = expandEnv("host: ${IGNITION_TEST_HOST")
+	assert.Error(t, err)
+	_, err = expandEnv("host: ${:-x}")
+	assert.Error(t, err)
+}
+
+type envConf struct {
+	DBHost  string
+	Port    int                   `yaml:"port"`
+	Debug   bool                  `yaml:"debug"`
+	Timeout time.Duration         `yaml:"timeout"`
+	Tags    []string              `yaml:"tags"`
+	Secret  string                `yaml:"-"`
+	Pools   map[string]PoolConfig `yaml:"pools"`
+	Limit   *int                  `yaml:"limit"`
+}
+
+func TestConfigEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "conf.yml")
+	assert.Nil(t, os.WriteFile(file, []byte(`
+dbhost: localhost
+port: ${IGNITION_TEST_PORT:-5432}
+pools:
+  primary:
+    driver: postgres
+    password: ${IGNITION_TEST_PASSWORD}
+    options:
+      sslmode: disable
+`), 0644))
+	t.Setenv("IGNITION_TEST_PASSWORD", "secret")
+	t.Setenv("APP_DBHOST", "db.internal")
+	t.Setenv("APP_DEBUG", "true")
+	t.Setenv("APP_TIMEOUT", "3s")
+	t.Setenv("APP_TAGS", "a, b")
+	t.Setenv("APP_SECRET", "ignored")
+	t.Setenv("APP_LIMIT", "7")
+	t.Setenv("APP_POOLS_PRIMARY_MAX_ACTIVE", "20")
+	t.Setenv("APP_POOLS_PRIMARY_OPTIONS_SSLMODE", "require")
+	t.Setenv("APP_POOLS_REPLICA_HOST", "not in file")
+
+	conf := Config{EnvPrefix: "APP_"}
+	c := envConf{}
+	assert.Nil(t, conf.Load(file, &c))
+	assert.Equal(t, "db.internal", c.DBHost)
+	assert.Equal(t, 5432, c.Port)
+	assert.True(t, c.Debug)
+	assert.Equal(t, 3*time.Second, c.Timeout)
+	assert.Equal(t, []string{"a", "b"}, c.Tags)
+	assert.Equal(t, "", c.Secret)
+	assert.Equal(t, 7, *c.Limit)
+	assert.Len(t, c.Pools, 1)
+	primary := c.Pools["primary"]
+	assert.Equal(t, "secret", primary.Password)
+	assert.Equal(t, 20, primary.MaxActive)
+	assert.Equal(t, "require", primary.Options["sslmode"])
+
+	t.Setenv("APP_PORT", "http")
+	assert.Error(t, conf.Load(file, &envConf{}))
+}
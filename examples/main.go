@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/limen/ignition"
 	"github.com/limen/ignition/auth"
+	"github.com/limen/ignition/gormpool"
+	"github.com/limen/ignition/metrics"
 	"github.com/limen/ignition/middlewares"
 	"github.com/limen/ignition/validation"
 	"strings"
@@ -48,13 +51,9 @@ type UserModel struct {
 
 // environment configuration
 type config struct {
-	Timezone   string `yml:"timezone"`
-	Locale     string `yml:"locale"`
-	DbHost     string `yml:"dbhost"`
-	DbName     string `yml:"dbname"`
-	DbPort     int    `yml:"dbport"`
-	DbUser     string `yml:"dbuser"`
-	DbPassword string `yml:"dbpassword"`
+	Timezone string                         `yml:"timezone"`
+	Locale   string                         `yml:"locale"`
+	Pools    map[string]ignition.PoolConfig `yaml:"pools"`
 }
 
 // implements AuthProviderInterface
@@ -72,28 +71,11 @@ type MyUser struct {
 	User UserModelEntity
 }
 
-// postgres connection pool
-var pgPool = &ignition.Pool{
-	MaxActive: 10,
-	MaxIdle:   1,
-	Dial: func() (ignition.Conn, error) {
-		dsn := fmt.Sprintf(
-			"host=%s port=%d user=%s dbname=%s password=%s sslmode=%s",
-			conf.DbHost,
-			conf.DbPort,
-			conf.DbUser,
-			conf.DbName,
-			conf.DbPassword,
-			"disable",
-		)
-		db, err := gorm.Open("postgres", dsn)
-		if err != nil {
-			panic("Database connection failed:" + err.Error())
-		}
+// postgres connection pool, built from the "pools" section of .env.yml
+var pgPool *gormpool.Pool
 
-		return db, db.Error
-	},
-}
+// all connection pools
+var pools *ignition.Registry
 
 var conf config
 var confLoader ignition.Config
@@ -108,6 +90,11 @@ var getterMap = map[string]ignition.Getter{
 	"locale": LocaleGetter,
 }
 
+func init() {
+	// driver for pools with "driver: postgres"
+	ignition.RegisterDriver("postgres", gormpool.Driver("postgres"))
+}
+
 func newUserPostEntity(ctx *gin.Context) UserPostEntity {
 	e := UserPostEntity{}
 	// validation rules
@@ -142,33 +129,26 @@ func NewUserModel() *UserModel {
 }
 
 // create user
-func (m *UserModel) Create(username string, password string) (uint, error) {
-	db, err := pgPool.Get()
-	if err != nil {
-		panic(err)
-	}
-	defer db.Close()
-
+func (m *UserModel) Create(ctx context.Context, username string, password string) (uint, error) {
 	user := UserModelEntity{
 		Username: username,
 		Password: password,
 	}
-	userErr := db.GetDB().Create(&user).Error
+	err := gormpool.WithTx(ctx, pgPool, func(tx *gorm.DB) error {
+		return tx.Create(&user).Error
+	})
 
-	return user.ID, userErr
+	return user.ID, err
 }
 
 // find user
-func (m *UserModel) Find(username string) (UserModelEntity, error) {
-	db, err := pgPool.Get()
-	if err != nil {
-		panic(err)
-	}
-	defer db.Close()
-
+func (m *UserModel) Find(ctx context.Context, username string) (UserModelEntity, error) {
 	user := UserModelEntity{}
-	dbErr := db.GetDB().Where("username=?", username).First(&user).Error
-	return user, dbErr
+	err := pgPool.WithConn(ctx, func(db *gormpool.PooledConn) error {
+		return db.Conn.Where("username=?", username).First(&user).Error
+	})
+
+	return user, err
 }
 
 // getter business logic
@@ -231,6 +211,21 @@ func main() {
 	r := gin.New()
 	// load yaml configuration file
 	confLoader.Load(".env.yml", &conf)
+	// build connection pools
+	var err error
+	pools, err = ignition.NewRegistry(conf.Pools)
+	if err != nil {
+		panic(err)
+	}
+	defer pools.Close()
+	pgPool, err = ignition.GetPool[*gorm.DB](pools, "primary")
+	if err != nil {
+		panic(err)
+	}
+	// pre-dial database connections
+	if err := pools.Warm(context.Background()); err != nil {
+		fmt.Println("Warm connection pools failed:", err)
+	}
 	authHandler := middlewares.AuthHandler{}
 	authHandler.AuthProvider = AuthProvider{}
 	authHandler.AbortFunc = func(ctx *gin.Context, err error) {
@@ -238,6 +233,11 @@ func main() {
 		ignition.Response.Error(ctx, "AuthError", "", nil)
 	}
 
+	// prometheus metrics for pools and requests, served before authorization
+	m := metrics.New()
+	m.AddRegistry(pools)
+	r.Use(m.Middleware())
+	m.Register(r, "/metrics")
 	// middleware for access log
 	r.Use(middlewares.AccessLogHandler())
 	// middleware for panic log
@@ -248,7 +248,7 @@ func main() {
 	// get user info
 	r.GET("/user-info", func(ctx *gin.Context) {
 		data := map[string]interface{}{}
-		user, err := NewUserModel().Find(ctx.Query("username"))
+		user, err := NewUserModel().Find(ctx.Request.Context(), ctx.Query("username"))
 		data["user"] = user
 		data["error"] = err
 		ignition.Response.Success(ctx, data)
@@ -265,7 +265,7 @@ func main() {
 			ignition.Response.Error(ctx, "ParamError", "Param validation failed", entity.Errors)
 		} else {
 			userData := entity.Data.(UserData)
-			_, err := NewUserModel().Create(userData.Username, userData.Password)
+			_, err := NewUserModel().Create(ctx.Request.Context(), userData.Username, userData.Password)
 			if err != nil {
 				ignition.Response.Error(ctx, "DatabaseError", "Create user error:"+err.Error(), nil)
 			} else {
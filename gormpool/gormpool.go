@@ -0,0 +1,127 @@
+// gorm连接池适配
+package gormpool
+
+import (
+	"context"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/limen/ignition"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gorm连接池
+type Pool = ignition.Pool[*gorm.DB]
+
+// 池中gorm连接
+type PooledConn = ignition.PooledConn[*gorm.DB]
+
+// 创建gorm连接的Dial函数
+func Dial(dialect string, args ...interface{}) func() (*gorm.DB, error) {
+	return func() (*gorm.DB, error) {
+		return gorm.Open(dialect, args...)
+	}
+}
+
+// 借出前ping连接，用作Pool.TestOnBorrow
+func Ping(db *gorm.DB, idleSince time.Time) error {
+	return db.DB().Ping()
+}
+
+// 在池中连接上执行事务
+// fn返回nil时提交，返回错误或panic时回滚，连接总会归还
+func WithTx(ctx context.Context, p *Pool, fn func(tx *gorm.DB) error) error {
+	return p.WithConn(ctx, func(pc *PooledConn) (err error) {
+		tx := pc.Conn.BeginTx(ctx, nil)
+		if tx.Error != nil {
+			return tx.Error
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+				panic(r)
+			}
+		}()
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		return tx.Commit().Error
+	})
+}
+
+// 按配置创建gorm连接池的驱动
+//
+//	ignition.RegisterDriver("postgres", gormpool.Driver("postgres"))
+func Driver(dialect string) ignition.Driver {
+	dial := func(conf ignition.PoolConfig) (*gorm.DB, error) {
+		dsn, err := DSN(dialect, conf)
+		if err != nil {
+			return nil, err
+		}
+		return gorm.Open(dialect, dsn)
+	}
+	setup := func(p *Pool, conf ignition.PoolConfig) {
+		if conf.TestOnBorrow {
+			p.TestOnBorrow = Ping
+		}
+	}
+
+	return ignition.NewDriver(dial, setup)
+}
+
+// 由配置生成连接串
+// 支持postgres和mysql，其他dialect须在配置中设置dsn
+func DSN(dialect string, conf ignition.PoolConfig) (string, error) {
+	if conf.DSN != "" {
+		return conf.DSN, nil
+	}
+
+	keys := make([]string, 0, len(conf.Options))
+	for k := range conf.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	switch dialect {
+	case "postgres":
+		params := []string{
+			"host=" + pgQuote(conf.Host),
+			"port=" + strconv.Itoa(conf.Port),
+			"user=" + pgQuote(conf.User),
+			"dbname=" + pgQuote(conf.Database),
+			"password=" + pgQuote(conf.Password),
+		}
+		for _, k := range keys {
+			params = append(params, k+"="+pgQuote(conf.Options[k]))
+		}
+		return strings.Join(params, " "), nil
+	case "mysql":
+		query := url.Values{}
+		for _, k := range keys {
+			query.Set(k, conf.Options[k])
+		}
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", conf.User, conf.Password, conf.Host, conf.Port, conf.Database)
+		if len(query) > 0 {
+			dsn += "?" + query.Encode()
+		}
+		return dsn, nil
+	}
+
+	return "", fmt.Errorf("dsn is required for dialect %s", dialect)
+}
+
+// postgres连接串中的值，含空格或引号时加引号
+func pgQuote(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `'`, `\'`, -1)
+
+	return "'" + v + "'"
+}
@@ -0,0 +1,130 @@
+package gormpool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+// 记录事务操作的database/sql驱动
+type txDriver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (d *txDriver) record(event string) {
+	d.mu.Lock()
+	d.events = append(d.events, event)
+	d.mu.Unlock()
+}
+
+// 返回并清空记录的事务操作
+func (d *txDriver) take() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	events := d.events
+	d.events = nil
+	return events
+}
+
+func (d *txDriver) Open(name string) (driver.Conn, error) {
+	return &txConn{d: d}, nil
+}
+
+type txConn struct {
+	d *txDriver
+}
+
+func (c *txConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *txConn) Close() error {
+	return nil
+}
+
+func (c *txConn) Begin() (driver.Tx, error) {
+	c.d.record("begin")
+	return &txTx{d: c.d}, nil
+}
+
+type txTx struct {
+	d *txDriver
+}
+
+func (tx *txTx) Commit() error {
+	tx.d.record("commit")
+	return nil
+}
+
+func (tx *txTx) Rollback() error {
+	tx.d.record("rollback")
+	return nil
+}
+
+var testDriver = &txDriver{}
+
+func init() {
+	sql.Register("gormpool_test", testDriver)
+}
+
+func newTestPool() *Pool {
+	return &Pool{
+		MaxActive: 1,
+		MaxIdle:   1,
+		Wait:      true,
+		Dial:      Dial("common", "gormpool_test", "test"),
+	}
+}
+
+// 连接已归还到池中
+func assertReturned(t *testing.T, p *Pool) {
+	s := p.Stats()
+	assert.Equal(t, 0, s.InUse)
+	assert.Equal(t, 1, s.IdleCount)
+}
+
+func TestWithTx(t *testing.T) {
+	p := newTestPool()
+	defer p.Close()
+	ctx := context.Background()
+	testDriver.take()
+
+	// fn返回nil时提交
+	called := false
+	err := WithTx(ctx, p, func(tx *gorm.DB) error {
+		called = true
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.True(t, called)
+	assert.Equal(t, []string{"begin", "commit"}, testDriver.take())
+	assertReturned(t, p)
+
+	// fn返回错误时回滚并返回该错误
+	fnErr := errors.New("fn failed")
+	err = WithTx(ctx, p, func(tx *gorm.DB) error {
+		return fnErr
+	})
+	assert.Equal(t, fnErr, err)
+	assert.Equal(t, []string{"begin", "rollback"}, testDriver.take())
+	assertReturned(t, p)
+
+	// fn panic时回滚并继续panic
+	assert.PanicsWithValue(t, "fn panicked", func() {
+		WithTx(ctx, p, func(tx *gorm.DB) error {
+			panic("fn panicked")
+		})
+	})
+	assert.Equal(t, []string{"begin", "rollback"}, testDriver.take())
+	assertReturned(t, p)
+
+	// 同一个连接被复用
+	assert.Equal(t, int64(1), p.Stats().Dials)
+}
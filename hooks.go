@@ -0,0 +1,69 @@
+package ignition
+
+import (
+	"fmt"
+	"time"
+)
+
+// 连接关闭原因
+type CloseReason string
+
+const (
+	CloseMaxIdle     CloseReason = "max_idle"     // 超过MaxIdle
+	CloseMaxActive   CloseReason = "max_active"   // MaxActive调小后多出
+	CloseIdleTimeout CloseReason = "idle_timeout" // 空闲超时
+	CloseMaxLifetime CloseReason = "max_lifetime" // 超过MaxConnLifetime
+	CloseMaxUses     CloseReason = "max_uses"     // 达到MaxUses
+	CloseBroken      CloseReason = "broken"       // TestOnBorrow检查失败
+	CloseDiscarded   CloseReason = "discarded"    // 被Discard或标记为不可用
+	CloseResetFailed CloseReason = "reset_failed" // OnReturn重置失败
+	ClosePoolClosed  CloseReason = "pool_closed"  // 连接池已关闭
+	CloseForced      CloseReason = "forced"       // Shutdown超时强制关闭
+)
+
+// 待关闭的连接
+type closing[T Conn] struct {
+	conn   T
+	reason CloseReason
+}
+
+// 关闭连接并回调OnClose
+// 调用时不能持有p.mu
+func (p *Pool[T]) closeConn(conn T, reason CloseReason) {
+	conn.Close()
+	if p.OnClose != nil {
+		p.OnClose(conn, reason)
+	}
+}
+
+// 新建连接后回调OnDial
+func (p *Pool[T]) dialed(conn T, start time.Time, err error) {
+	elapsed := time.Since(start)
+	if err == nil {
+		p.mu.Lock()
+		p.stats.dialDuration += elapsed
+		p.mu.Unlock()
+	}
+	if p.OnDial != nil {
+		p.OnDial(conn, elapsed, err)
+	}
+}
+
+// 借出连接后回调OnGet
+func (p *Pool[T]) got(pc *PooledConn[T], wait time.Duration) {
+	if p.OnGet != nil {
+		p.OnGet(pc.Conn, wait)
+	}
+}
+
+// 归还连接时回调OnReturn重置连接状态
+// OnReturn panic时视为重置失败，以免连接和名额无法释放
+func (p *Pool[T]) reset(conn T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("OnReturn panic: %v", r)
+		}
+	}()
+
+	return p.OnReturn(conn)
+}
@@ -0,0 +1,118 @@
+package ignition
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+
+	p := newTestPool(2, 1)
+	p.OnDial = func(conn *testConn, elapsed time.Duration, err error) {
+		record("dial")
+	}
+	p.OnGet = func(conn *testConn, wait time.Duration) {
+		record("get")
+	}
+	p.OnPut = func(conn *testConn) {
+		record("put")
+	}
+	p.OnClose = func(conn *testConn, reason CloseReason) {
+		// hooks run without the pool lock held
+		p.Stats()
+		record("close:" + string(reason))
+	}
+
+	pc1, err := p.Get()
+	assert.Nil(t, err)
+	pc2, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc1.Close())
+	assert.Nil(t, pc2.Close())
+	pc1, err = p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc1.Discard())
+	assert.Nil(t, p.Close())
+
+	assert.Equal(t, []string{
+		"dial", "get",
+		"dial", "get",
+		"put",
+		"put", "close:max_idle",
+		"get",
+		"put", "close:discarded",
+	}, events)
+}
+
+func TestPoolOnReturn(t *testing.T) {
+	p := newTestPool(2, 2)
+	defer p.Close()
+	dirty := map[*testConn]bool{}
+	p.OnReturn = func(conn *testConn) error {
+		if dirty[conn] {
+			return errors.New("transaction still open")
+		}
+		return nil
+	}
+	var reasons []CloseReason
+	p.OnClose = func(conn *testConn, reason CloseReason) {
+		reasons = append(reasons, reason)
+	}
+
+	pc1, err := p.Get()
+	assert.Nil(t, err)
+	pc2, err := p.Get()
+	assert.Nil(t, err)
+	dirty[pc2.Conn] = true
+	assert.Nil(t, pc1.Close())
+	assert.Nil(t, pc2.Close())
+
+	s := p.Stats()
+	assert.Equal(t, 1, s.IdleCount)
+	assert.Equal(t, 1, s.ActiveCount)
+	assert.Equal(t, int64(1), s.ResetFailures)
+	assert.Equal(t, []CloseReason{CloseResetFailed}, reasons)
+	assert.Equal(t, ErrConnReturned, pc2.Close())
+}
+
+func TestPoolOnReturnPanic(t *testing.T) {
+	p := newTestPool(1, 1)
+	defer p.Close()
+	p.OnReturn = func(conn *testConn) error {
+		panic("reset failed")
+	}
+	var reasons []CloseReason
+	p.OnClose = func(conn *testConn, reason CloseReason) {
+		reasons = append(reasons, reason)
+	}
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, []CloseReason{CloseResetFailed}, reasons)
+	s := p.Stats()
+	assert.Equal(t, 0, s.ActiveCount)
+	assert.Equal(t, int64(1), s.ResetFailures)
+
+	// the slot is released, so the next Get does not wait
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	pc, err = p.GetContext(ctx)
+	assert.Nil(t, err)
+	p.OnReturn = nil
+	assert.Nil(t, pc.Close())
+	forced, err := p.Shutdown(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, forced, 0)
+}
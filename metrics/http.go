@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 请求指标的标签
+type requestKey struct {
+	method string
+	route  string
+	status string
+}
+
+// 请求计数和耗时分布
+type requestStats struct {
+	count   uint64
+	sum     float64
+	buckets []uint64 // 与Collector.Buckets对应，不累加
+}
+
+// 记录请求指标的中间件
+// route取gin路由模板，如/users/:id，未匹配路由的请求记为空
+func (c *Collector) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+		c.observe(requestKey{
+			method: ctx.Request.Method,
+			route:  ctx.FullPath(),
+			status: strconv.Itoa(ctx.Writer.Status()),
+		}, time.Since(start).Seconds())
+	}
+}
+
+func (c *Collector) observe(key requestKey, seconds float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.requests == nil {
+		c.requests = map[requestKey]*requestStats{}
+	}
+	s := c.requests[key]
+	if s == nil {
+		s = &requestStats{buckets: make([]uint64, len(c.Buckets))}
+		c.requests[key] = s
+	}
+	s.count++
+	s.sum += seconds
+	if i := sort.SearchFloat64s(c.Buckets, seconds); i < len(c.Buckets) {
+		s.buckets[i]++
+	}
+}
+
+func (c *Collector) writeRequests(w *countWriter) {
+	c.mu.Lock()
+	keys := make([]requestKey, 0, len(c.requests))
+	stats := make(map[requestKey]requestStats, len(c.requests))
+	for k, s := range c.requests {
+		keys = append(keys, k)
+		stats[k] = requestStats{count: s.count, sum: s.sum, buckets: append([]uint64(nil), s.buckets...)}
+	}
+	buckets := c.Buckets
+	c.mu.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	total := c.name("http_requests_total")
+	w.header(total, "counter", "Total number of HTTP requests.")
+	for _, k := range keys {
+		w.sample(total, k.labels(), float64(stats[k].count))
+	}
+
+	duration := c.name("http_request_duration_seconds")
+	w.header(duration, "histogram", "HTTP request latency in seconds.")
+	for _, k := range keys {
+		s := stats[k]
+		var cumulative uint64
+		for i, le := range buckets {
+			cumulative += s.buckets[i]
+			w.sample(duration+"_bucket", append(k.labels(), [2]string{"le", formatValue(le)}), float64(cumulative))
+		}
+		w.sample(duration+"_bucket", append(k.labels(), [2]string{"le", formatValue(math.Inf(1))}), float64(s.count))
+		w.sample(duration+"_sum", k.labels(), s.sum)
+		w.sample(duration+"_count", k.labels(), float64(s.count))
+	}
+}
+
+func (k requestKey) labels() labels {
+	return labels{{"method", k.method}, {"route", k.route}, {"status", k.status}}
+}
@@ -0,0 +1,257 @@
+// Prometheus指标导出
+// 以Prometheus文本格式输出连接池统计和HTTP请求指标
+//
+//	m := metrics.New()
+//	m.AddRegistry(pools)
+//	r.Use(m.Middleware())
+//	m.Register(r, "/metrics")
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/limen/ignition"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 默认指标名前缀
+const DefaultNamespace = "ignition"
+
+// 默认请求耗时分桶，单位秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// 提供连接池统计，*ignition.Pool、*ignition.ShardedPool等都实现了该接口
+type StatsProvider interface {
+	Stats() ignition.PoolStats
+}
+
+// 指标收集器
+type Collector struct {
+	// 指标名前缀，默认ignition
+	Namespace string
+	// 请求耗时分桶上限，单位秒，升序，默认DefaultBuckets
+	// 须在处理请求前设置
+	Buckets []float64
+
+	mu         sync.Mutex
+	pools      []StatsProvider
+	registries []*ignition.Registry
+	requests   map[requestKey]*requestStats
+}
+
+// 创建指标收集器
+func New() *Collector {
+	return &Collector{
+		Namespace: DefaultNamespace,
+		Buckets:   DefaultBuckets,
+		requests:  map[requestKey]*requestStats{},
+	}
+}
+
+// 添加连接池，以Stats().ID作为pool标签
+func (c *Collector) AddPool(p StatsProvider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pools = append(c.pools, p)
+}
+
+// 添加注册表中的所有连接池，以连接池名作为pool标签
+// 每次输出时读取注册表，之后添加的连接池也会输出
+func (c *Collector) AddRegistry(r *ignition.Registry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.registries = append(c.registries, r)
+}
+
+// 在指定路由上输出指标，path为空时使用/metrics
+func (c *Collector) Register(r gin.IRoutes, path string) {
+	if path == "" {
+		path = "/metrics"
+	}
+	r.GET(path, c.Handler())
+}
+
+// 输出指标的handler
+func (c *Collector) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var buf bytes.Buffer
+		c.WriteTo(&buf)
+		ctx.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+	}
+}
+
+// 以Prometheus文本格式写出所有指标
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	c.writePools(cw)
+	c.writeRequests(cw)
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+
+	return cw.n, cw.err
+}
+
+// 所有连接池的统计，按pool标签排序
+func (c *Collector) poolStats() []ignition.PoolStats {
+	c.mu.Lock()
+	pools := append([]StatsProvider(nil), c.pools...)
+	registries := append([]*ignition.Registry(nil), c.registries...)
+	c.mu.Unlock()
+
+	var stats []ignition.PoolStats
+	for _, p := range pools {
+		stats = append(stats, p.Stats())
+	}
+	for _, r := range registries {
+		for _, name := range r.Names() {
+			p, err := r.Get(name)
+			if err != nil {
+				continue
+			}
+			s := p.Stats()
+			s.ID = name
+			stats = append(stats, s)
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+
+	return stats
+}
+
+func (c *Collector) writePools(w *countWriter) {
+	stats := c.poolStats()
+	if len(stats) == 0 {
+		return
+	}
+
+	type family struct {
+		name, typ, help string
+		value           func(s ignition.PoolStats) float64
+	}
+	families := []family{
+		{"pool_max_active", "gauge", "Maximum number of open connections.", func(s ignition.PoolStats) float64 { return float64(s.MaxActive) }},
+		{"pool_max_idle", "gauge", "Maximum number of idle connections.", func(s ignition.PoolStats) float64 { return float64(s.MaxIdle) }},
+		{"pool_active_connections", "gauge", "Number of open connections, idle and in use.", func(s ignition.PoolStats) float64 { return float64(s.ActiveCount) }},
+		{"pool_idle_connections", "gauge", "Number of idle connections.", func(s ignition.PoolStats) float64 { return float64(s.IdleCount) }},
+		{"pool_in_use_connections", "gauge", "Number of connections in use.", func(s ignition.PoolStats) float64 { return float64(s.InUse) }},
+		{"pool_waiting", "gauge", "Number of callers waiting for a connection.", func(s ignition.PoolStats) float64 { return float64(s.Waiting) }},
+		{"pool_waits_total", "counter", "Total number of waits for a connection.", func(s ignition.PoolStats) float64 { return float64(s.WaitCount) }},
+		{"pool_wait_seconds_total", "counter", "Total time spent waiting for a connection.", func(s ignition.PoolStats) float64 { return s.WaitDuration.Seconds() }},
+		{"pool_hits_total", "counter", "Total number of idle connections reused.", func(s ignition.PoolStats) float64 { return float64(s.Hits) }},
+		{"pool_dials_total", "counter", "Total number of connections dialed.", func(s ignition.PoolStats) float64 { return float64(s.Dials) }},
+		{"pool_dial_errors_total", "counter", "Total number of failed dials.", func(s ignition.PoolStats) float64 { return float64(s.DialFailures) }},
+		{"pool_exhausted_total", "counter", "Total number of gets rejected with ErrPoolExhausted.", func(s ignition.PoolStats) float64 { return float64(s.Exhausted) }},
+		{"pool_breaker_rejects_total", "counter", "Total number of dials rejected by the open circuit breaker.", func(s ignition.PoolStats) float64 { return float64(s.BreakerRejects) }},
+		{"pool_leaked_connections", "gauge", "Number of connections held longer than the leak threshold.", func(s ignition.PoolStats) float64 { return float64(s.Leaked) }},
+		{"pool_leaks_total", "counter", "Total number of leaked connections reported.", func(s ignition.PoolStats) float64 { return float64(s.LeakCount) }},
+	}
+	for _, f := range families {
+		w.header(c.name(f.name), f.typ, f.help)
+		for _, s := range stats {
+			w.sample(c.name(f.name), labels{{"pool", s.ID}}, f.value(s))
+		}
+	}
+
+	closed := c.name("pool_closed_total")
+	w.header(closed, "counter", "Total number of connections closed by the pool, by reason.")
+	for _, s := range stats {
+		reasons := []struct {
+			reason ignition.CloseReason
+			n      int64
+		}{
+			{ignition.CloseMaxIdle, s.MaxIdleClosed},
+			{ignition.CloseIdleTimeout, s.IdleTimeoutClosed},
+			{ignition.CloseMaxLifetime, s.LifetimeClosed},
+			{ignition.CloseMaxUses, s.MaxUsesClosed},
+			{ignition.CloseDiscarded, s.Discarded},
+			{ignition.CloseResetFailed, s.ResetFailures},
+		}
+		for _, r := range reasons {
+			w.sample(closed, labels{{"pool", s.ID}, {"reason", string(r.reason)}}, float64(r.n))
+		}
+	}
+
+	breaker := c.name("pool_breaker_state")
+	w.header(breaker, "gauge", "Circuit breaker state, 1 for the current state.")
+	for _, s := range stats {
+		for _, state := range []string{ignition.BreakerClosed, ignition.BreakerOpen, ignition.BreakerHalfOpen} {
+			v := 0.0
+			if s.BreakerState == state {
+				v = 1
+			}
+			w.sample(breaker, labels{{"pool", s.ID}, {"state", state}}, v)
+		}
+	}
+}
+
+// 带前缀的指标名
+func (c *Collector) name(name string) string {
+	if c.Namespace == "" {
+		return name
+	}
+
+	return c.Namespace + "_" + name
+}
+
+// 标签，按顺序输出
+type labels [][2]string
+
+// 记录写出的字节数和第一个错误
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *countWriter) header(name, typ, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (w *countWriter) sample(name string, ls labels, v float64) {
+	w.printf("%s%s %s\n", name, formatLabels(ls), formatValue(v))
+}
+
+func formatLabels(ls labels) string {
+	if len(ls) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range ls {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l[0])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(l[1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/limen/ignition"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testConn struct{}
+
+func (testConn) Close() error { return nil }
+
+func TestPoolMetrics(t *testing.T) {
+	p := &ignition.Pool[testConn]{
+		ID:        `db"1`,
+		MaxActive: 2,
+		MaxIdle:   1,
+		Dial: func() (testConn, error) {
+			return testConn{}, nil
+		},
+	}
+	defer p.Close()
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Discard())
+
+	m := New()
+	m.AddPool(p)
+	var buf bytes.Buffer
+	_, err = m.WriteTo(&buf)
+	assert.Nil(t, err)
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE ignition_pool_max_active gauge\n")
+	assert.Contains(t, out, `ignition_pool_max_active{pool="db\"1"} 2`+"\n")
+	assert.Contains(t, out, `ignition_pool_dials_total{pool="db\"1"} 1`+"\n")
+	assert.Contains(t, out, `ignition_pool_closed_total{pool="db\"1",reason="discarded"} 1`+"\n")
+	assert.Contains(t, out, `ignition_pool_breaker_state{pool="db\"1",state="closed"} 1`+"\n")
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+	m.Buckets = []float64{0.1, 1}
+	r := gin.New()
+	r.Use(m.Middleware())
+	m.Register(r, "/internal/metrics")
+	r.GET("/users/:id", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ok")
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/internal/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	out := w.Body.String()
+	assert.Contains(t, out, "# TYPE ignition_http_requests_total counter\n")
+	assert.Contains(t, out, `ignition_http_requests_total{method="GET",route="/users/:id",status="200"} 2`+"\n")
+	assert.Contains(t, out, `ignition_http_requests_total{method="GET",route="",status="404"} 1`+"\n")
+	assert.Contains(t, out, `ignition_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="200",le="+Inf"} 2`+"\n")
+	assert.Contains(t, out, `ignition_http_request_duration_seconds_count{method="GET",route="/users/:id",status="200"} 2`+"\n")
+	assert.NotContains(t, out, "ignition_pool_")
+}
@@ -0,0 +1,47 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd || solaris
+
+package netpool
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// 空闲连接上读到了未预期的数据
+var ErrUnexpectedRead = errors.New("unexpected read from idle connection")
+
+// 对连接做一次非阻塞的1字节读取
+// 连接正常时读取返回EAGAIN
+func connCheck(conn net.Conn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var n int
+	var readErr error
+	buf := make([]byte, 1)
+	err = rc.Read(func(fd uintptr) bool {
+		n, readErr = syscall.Read(int(fd), buf)
+		// 不等待可读
+		return true
+	})
+	switch {
+	case err != nil:
+		return err
+	case n == 0 && readErr == nil:
+		return io.EOF
+	case n > 0:
+		return ErrUnexpectedRead
+	case readErr == syscall.EAGAIN || readErr == syscall.EWOULDBLOCK:
+		return nil
+	default:
+		return readErr
+	}
+}
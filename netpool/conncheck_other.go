@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !solaris
+
+package netpool
+
+import (
+	"errors"
+	"net"
+)
+
+// 空闲连接上读到了未预期的数据
+var ErrUnexpectedRead = errors.New("unexpected read from idle connection")
+
+// 当前平台不支持非阻塞读取检查
+func connCheck(conn net.Conn) error {
+	return nil
+}
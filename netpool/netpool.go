@@ -0,0 +1,154 @@
+// net.Conn连接池适配，用于自定义文本协议、memcached等TCP服务
+package netpool
+
+import (
+	"fmt"
+	"github.com/limen/ignition"
+	"net"
+	"strconv"
+	"time"
+)
+
+// net.Conn连接池
+type Pool = ignition.Pool[net.Conn]
+
+// 池中net.Conn连接
+type PooledConn = ignition.PooledConn[net.Conn]
+
+// 连接选项
+type Options struct {
+	// 网络类型，默认tcp
+	Network string
+	// 地址，如127.0.0.1:11211
+	Addr string
+	// 新建连接超时，0表示不限制
+	DialTimeout time.Duration
+	// TCP keepalive间隔，0使用系统默认值，小于0关闭keepalive
+	KeepAlive time.Duration
+	// 每次借出后读写的截止时间，从借出时开始计算，0表示不限制
+	// 复用空闲连接时由TestOnBorrow设置
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// 复用空闲连接前检查对端是否已关闭
+	TestAlive bool
+}
+
+// 创建连接的Dial函数
+func Dial(opt Options) func() (net.Conn, error) {
+	network := opt.Network
+	if network == "" {
+		network = "tcp"
+	}
+	d := &net.Dialer{Timeout: opt.DialTimeout, KeepAlive: opt.KeepAlive}
+
+	return func() (net.Conn, error) {
+		conn, err := d.Dial(network, opt.Addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := opt.setDeadlines(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	}
+}
+
+// 借出前检查连接，用作Pool.TestOnBorrow
+// 设置TestAlive时，对端已关闭或有未读数据的连接返回错误
+// 然后按选项设置本次借出的读写截止时间
+func TestOnBorrow(opt Options) func(conn net.Conn, idleSince time.Time) error {
+	return func(conn net.Conn, idleSince time.Time) error {
+		if opt.TestAlive {
+			if err := CheckAlive(conn, idleSince); err != nil {
+				return err
+			}
+		}
+
+		return opt.setDeadlines(conn)
+	}
+}
+
+// 检查空闲连接是否仍可用
+// 非阻塞读取连接，对端已关闭时返回io.EOF，收到未预期的数据时返回ErrUnexpectedRead
+// 不支持的平台或连接类型不做检查
+// 上次借出设置的读截止时间会被清除，否则过期后检查总是失败
+func CheckAlive(conn net.Conn, idleSince time.Time) error {
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	return connCheck(conn)
+}
+
+// 设置读写截止时间
+func (opt Options) setDeadlines(conn net.Conn) error {
+	now := time.Now()
+	var rd, wd time.Time
+	if opt.ReadTimeout > 0 {
+		rd = now.Add(opt.ReadTimeout)
+	}
+	if opt.WriteTimeout > 0 {
+		wd = now.Add(opt.WriteTimeout)
+	}
+	if err := conn.SetReadDeadline(rd); err != nil {
+		return err
+	}
+
+	return conn.SetWriteDeadline(wd)
+}
+
+// 按配置创建net.Conn连接池的驱动
+// dsn为host:port格式的地址，options支持network、dial_timeout、keepalive、read_timeout和write_timeout
+// 设置test_on_borrow时复用空闲连接前检查对端是否已关闭
+//
+//	ignition.RegisterDriver("tcp", netpool.Driver())
+func Driver() ignition.Driver {
+	dial := func(conf ignition.PoolConfig) (net.Conn, error) {
+		opt, err := ParseOptions(conf)
+		if err != nil {
+			return nil, err
+		}
+		return Dial(opt)()
+	}
+	setup := func(p *Pool, conf ignition.PoolConfig) {
+		opt, err := ParseOptions(conf)
+		if err == nil && (opt.TestAlive || opt.ReadTimeout > 0 || opt.WriteTimeout > 0) {
+			p.TestOnBorrow = TestOnBorrow(opt)
+		}
+	}
+
+	return ignition.NewDriver(dial, setup)
+}
+
+// 由配置生成连接选项
+func ParseOptions(conf ignition.PoolConfig) (Options, error) {
+	opt := Options{
+		Network:   conf.Options["network"],
+		Addr:      conf.DSN,
+		TestAlive: conf.TestOnBorrow,
+	}
+	if opt.Addr == "" {
+		opt.Addr = net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port))
+	}
+	durations := map[string]*time.Duration{
+		"dial_timeout":  &opt.DialTimeout,
+		"keepalive":     &opt.KeepAlive,
+		"read_timeout":  &opt.ReadTimeout,
+		"write_timeout": &opt.WriteTimeout,
+	}
+	for name, d := range durations {
+		v, ok := conf.Options[name]
+		if !ok {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return opt, fmt.Errorf("invalid %s %q", name, v)
+		}
+		*d = parsed
+	}
+
+	return opt, nil
+}
@@ -0,0 +1,126 @@
+package netpool
+
+import (
+	"github.com/limen/ignition"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 接受连接并交给handle处理的本地服务
+func listen(t *testing.T, handle func(conn net.Conn)) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+
+	return ln
+}
+
+func TestCheckAlive(t *testing.T) {
+	closeNow := make(chan struct{})
+	ln := listen(t, func(conn net.Conn) {
+		<-closeNow
+		conn.Close()
+	})
+	defer ln.Close()
+
+	conn, err := Dial(Options{Addr: ln.Addr().String(), DialTimeout: time.Second})()
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, CheckAlive(conn, time.Now()))
+
+	close(closeNow)
+	assert.Eventually(t, func() bool {
+		return CheckAlive(conn, time.Now()) == io.EOF
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPoolReplacesClosedConn(t *testing.T) {
+	ln := listen(t, func(conn net.Conn) {
+		// 回显一行后关闭连接
+		buf := make([]byte, 64)
+		n, _ := conn.Read(buf)
+		conn.Write(buf[:n])
+		conn.Close()
+	})
+	defer ln.Close()
+
+	opt := Options{Addr: ln.Addr().String(), ReadTimeout: time.Second, TestAlive: true}
+	p := &Pool{Dial: Dial(opt), TestOnBorrow: TestOnBorrow(opt), MaxActive: 1, MaxIdle: 1, Wait: true}
+	defer p.Close()
+
+	echo := func() {
+		pc, err := p.Get()
+		assert.Nil(t, err)
+		defer pc.Close()
+		_, err = pc.Conn.Write([]byte("ping\n"))
+		assert.Nil(t, err)
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(pc.Conn, buf)
+		assert.Nil(t, err)
+		assert.Equal(t, "ping\n", string(buf))
+	}
+	echo()
+	// 等待服务端关闭连接
+	time.Sleep(50 * time.Millisecond)
+	echo()
+
+	stats := p.Stats()
+	assert.Equal(t, int64(2), stats.Dials)
+	assert.Equal(t, int64(0), stats.Hits)
+}
+
+func TestPoolReusesConnPastReadTimeout(t *testing.T) {
+	ln := listen(t, func(conn net.Conn) {
+		// 持续回显直到客户端关闭
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+	defer ln.Close()
+
+	opt := Options{Addr: ln.Addr().String(), ReadTimeout: 20 * time.Millisecond, TestAlive: true}
+	p := &Pool{Dial: Dial(opt), TestOnBorrow: TestOnBorrow(opt), MaxActive: 1, MaxIdle: 1, Wait: true}
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		pc, err := p.Get()
+		assert.Nil(t, err)
+		_, err = pc.Conn.Write([]byte("ping\n"))
+		assert.Nil(t, err)
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(pc.Conn, buf)
+		assert.Nil(t, err)
+		assert.Nil(t, pc.Close())
+		// 空闲时间超过ReadTimeout
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	stats := p.Stats()
+	assert.Equal(t, int64(1), stats.Dials)
+	assert.Equal(t, int64(2), stats.Hits)
+}
+
+func TestParseOptions(t *testing.T) {
+	opt, err := ParseOptions(ignition.PoolConfig{
+		Host:    "127.0.0.1",
+		Port:    11211,
+		Options: map[string]string{"dial_timeout": "2s", "read_timeout": "500ms"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:11211", opt.Addr)
+	assert.Equal(t, 2*time.Second, opt.DialTimeout)
+	assert.Equal(t, 500*time.Millisecond, opt.ReadTimeout)
+
+	_, err = ParseOptions(ignition.PoolConfig{DSN: "localhost:1", Options: map[string]string{"keepalive": "x"}})
+	assert.NotNil(t, err)
+}
@@ -1,103 +1,382 @@
 package ignition
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/go-redis/redis"
-	"github.com/jinzhu/gorm"
 	"github.com/limen/fargo/utils"
-	"reflect"
+	"runtime/debug"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
 var ErrPoolExhausted = errors.New("connection pool exhausted")
 
+var ErrPoolClosed = errors.New("get on closed pool")
+
+// 等待连接超时（context deadline已过）
+var ErrPoolTimeout = errors.New("connection pool timeout")
+
+// 连接已归还
+var ErrConnReturned = errors.New("connection already returned to pool")
+
+// 空闲连接复用策略
+type IdleStrategy int
+
+const (
+	// 优先复用最近归还的连接，空闲连接较少时多余的连接会因空闲超时被关闭
+	LIFO IdleStrategy = iota
+	// 优先复用最早归还的连接，使负载分散到所有连接上
+	FIFO
+)
+
 // 连接接口
 type Conn interface {
 	Close() error
 }
 
-type Pool struct {
+// 连接池，T为连接类型
+type Pool[T Conn] struct {
 	ID string
 	// 创建连接对象
-	Dial func() (Conn, error)
+	Dial func() (T, error)
 	// 可存在的最大连接数
+	// 连接池使用后须通过SetMaxActive修改
 	MaxActive int
 	// 最大空闲连接数
-	MaxIdle         int
-	IdleTimeout     time.Duration
+	// 连接池使用后须通过SetMaxIdle修改
+	MaxIdle int
+	// 最小空闲连接数，由Warm和维护协程补足
+	// 不超过MaxIdle，且总连接数不超过MaxActive
+	MinIdle int
+	// 空闲超时，超时的空闲连接将被关闭
+	IdleTimeout time.Duration
+	// 连接最长存活时间，超过的连接将被关闭
 	MaxConnLifetime time.Duration
+	// 每个连接最多借出的次数，达到后归还时关闭，0表示不限制
+	MaxUses int
+	// 空闲连接复用策略，默认LIFO
+	IdleStrategy IdleStrategy
+	// 借出前检查连接是否可用，idleSince为连接归还时间
+	// 返回错误时关闭该连接，并尝试下一个空闲连接或新建连接
+	TestOnBorrow func(conn T, idleSince time.Time) error
+	// 新建连接失败后的重试次数
+	DialRetries int
+	// 重试退避初始间隔，每次重试翻倍并加入随机抖动，默认100ms
+	DialBackoff time.Duration
+	// 重试退避最大间隔，0表示不限制
+	DialMaxBackoff time.Duration
+	// 连续新建连接失败达到该次数时熔断，0表示不熔断
+	// 熔断期间新建连接直接返回*BreakerOpenError
+	BreakerThreshold int
+	// 熔断持续时间，之后半开放行一次探测，默认5s
+	BreakerCooldown time.Duration
+	// 后台维护周期
+	// 大于0时启动维护协程，定期关闭空闲超时和超过存活时间的连接，补足MinIdle，并按Adaptive调整MaxActive
+	MaintenanceInterval time.Duration
+	// 泄漏检测阈值
+	// 大于0时记录借出连接的调用栈，借出超过该时间未归还的连接视为泄漏
+	LeakThreshold time.Duration
+	// 发现泄漏时回调，每个连接只报告一次
+	// 由维护协程调用，需同时设置MaintenanceInterval
+	OnLeak func(info LeakInfo)
+	// 自适应连接数上限，nil表示不启用
+	Adaptive *Adaptive
+	// 新建连接后回调，elapsed为耗时，失败时conn为零值
+	// 每次重试都会回调
+	OnDial func(conn T, elapsed time.Duration, err error)
+	// 借出连接后回调，wait为等待名额的时间
+	OnGet func(conn T, wait time.Duration)
+	// 归还连接时重置连接状态，如回滚未结束的事务、切回默认db
+	// 返回错误时关闭该连接，不再放回连接池
+	OnReturn func(conn T) error
+	// 归还连接后回调
+	OnPut func(conn T)
+	// 关闭连接后回调
+	OnClose func(conn T, reason CloseReason)
 	// 是否等待
-	Wait          bool
-	chInitialized uint32
-	mu            sync.Mutex    // mu protects the following fields
-	closed        bool          // set to true when the pool is closed.
-	active        int           // the number of open connections in the pool
-	ch            chan struct{} // limits open connections when p.Wait is true
-	idle          idleList      // idle connections
+	Wait         bool
+	mu           sync.Mutex                  // mu protects the following fields
+	closed       bool                        // set to true when the pool is closed.
+	active       int                         // the number of open connections in the pool
+	slots        int                         // the number of slots taken when p.Wait is true, limited by MaxActive
+	waiters      waitQueue                   // callers waiting for a slot
+	waitSeq      uint64                      // sequence number of the latest waiter
+	idle         idleList[T]                 // idle connections
+	maintaining  bool                        // set to true when the maintenance goroutine is started
+	stop         chan struct{}               // closed to stop the maintenance goroutine
+	stopped      chan struct{}               // closed when the maintenance goroutine exits
+	stats        poolCounters                // cumulative counters
+	borrowed     map[*PooledConn[T]]struct{} // connections checked out of the pool
+	drained      chan struct{}               // closed when all borrowed connections are returned after Shutdown
+	breaker      breaker                     // circuit breaker for dialing
+	adaptive     AdaptiveDecision            // latest decision of the adaptive controller
+	adaptiveLast poolCounters                // counters at the latest decision
+}
+
+// 累计计数，由p.mu保护
+type poolCounters struct {
+	waitCount         int64
+	waitDuration      time.Duration
+	hits              int64
+	dials             int64
+	dialFailures      int64
+	maxIdleClosed     int64
+	idleTimeoutClosed int64
+	lifetimeClosed    int64
+	leaks             int64
+	discarded         int64
+	resetFailures     int64
+	maxUsesClosed     int64
+	exhausted         int64
+	dialDuration      time.Duration
+	returns           int64
+	holdDuration      time.Duration
+	breakerRejects    int64
+}
+
+// 连接池统计
+type PoolStats struct {
+	ID string
+	// 配置
+	MaxActive int
+	MaxIdle   int
+
+	// 连接数
+	ActiveCount int // 已打开的连接数，包括空闲和使用中
+	IdleCount   int // 空闲连接数
+	InUse       int // 使用中的连接数
+	Waiting     int // 等待名额的调用方数
+
+	// 累计计数
+	WaitCount    int64         // 等待连接的次数
+	WaitDuration time.Duration // 等待连接的总时间
+	Hits         int64         // 复用空闲连接的次数
+	Dials        int64         // 新建连接的次数
+	DialFailures int64         // 新建连接失败的次数
+	Exhausted    int64         // 因连接数达到上限返回ErrPoolExhausted的次数
+
+	MaxIdleClosed     int64 // 因超过MaxIdle关闭的连接数
+	IdleTimeoutClosed int64 // 因超过IdleTimeout关闭的连接数
+	LifetimeClosed    int64 // 因超过MaxConnLifetime关闭的连接数
+	MaxUsesClosed     int64 // 因达到MaxUses关闭的连接数
+	Discarded         int64 // 被丢弃的连接数
+	ResetFailures     int64 // OnReturn失败而关闭的连接数
+
+	// 熔断
+	BreakerState   string // 熔断器状态
+	BreakerRejects int64  // 熔断期间拒绝新建连接的次数
+
+	// 泄漏检测
+	Leaked    int   // 当前借出超过LeakThreshold的连接数
+	LeakCount int64 // 已报告的泄漏总数
+
+	// 自适应调整的最近一次决定，未启用时为零值
+	Adaptive AdaptiveDecision
+}
+
+// 借出未归还的连接
+type LeakInfo struct {
+	PoolID     string
+	BorrowedAt time.Time     // 借出时间
+	HeldFor    time.Duration // 已借出时长
+	Stack      string        // 借出时的调用栈
 }
 
 // 空闲链表
 // 双向链表
 // front指向左侧头节点
 // back指向右侧头节点
-type idleList struct {
+type idleList[T Conn] struct {
 	count       int
-	front, back *PooledConn
+	front, back *PooledConn[T]
 }
 
 // 池中连接
-type PooledConn struct {
-	Conn Conn
+type PooledConn[T Conn] struct {
+	Conn T
 	// 所属连接池
-	pool *Pool
+	pool *Pool[T]
 	// 最后使用时间
 	latestUsedAt time.Time
 	// 创建时间
-	createdAt  time.Time
-	next, prev *PooledConn
+	createdAt time.Time
+	// 借出次数
+	uses int
+	// 借出时间和调用栈（开启泄漏检测时）
+	borrowedAt   time.Time
+	stack        []byte
+	leakReported bool
+	// 占用了名额
+	slot bool
+	// 已归还
+	returned bool
+	// 不可用，归还时丢弃
+	unusable   bool
+	next, prev *PooledConn[T]
 }
 
-func (pc *PooledConn) GetDB() *gorm.DB {
-	gc, ok := interface{}(pc.Conn).(*gorm.DB)
-	if !ok {
-		panic("type assertion failed: " + reflect.ValueOf(pc.Conn).Type().String())
+func (p *Pool[T]) Stat() utils.MapStr {
+	s := p.Stats()
+	return utils.MapStr{
+		"ID":          s.ID,
+		"idleCount":   s.IdleCount,
+		"maxActive":   s.MaxActive,
+		"maxIdle":     s.MaxIdle,
+		"activeCount": s.ActiveCount,
+		"id":          fmt.Sprintf("%v", &p),
 	}
+}
+
+// 连接池统计
+func (p *Pool[T]) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	return gc
+	return PoolStats{
+		ID:                p.ID,
+		MaxActive:         p.MaxActive,
+		MaxIdle:           p.MaxIdle,
+		ActiveCount:       p.active,
+		IdleCount:         p.idle.count,
+		InUse:             p.active - p.idle.count,
+		Waiting:           len(p.waiters),
+		WaitCount:         p.stats.waitCount,
+		WaitDuration:      p.stats.waitDuration,
+		Hits:              p.stats.hits,
+		Dials:             p.stats.dials,
+		DialFailures:      p.stats.dialFailures,
+		Exhausted:         p.stats.exhausted,
+		MaxIdleClosed:     p.stats.maxIdleClosed,
+		IdleTimeoutClosed: p.stats.idleTimeoutClosed,
+		LifetimeClosed:    p.stats.lifetimeClosed,
+		MaxUsesClosed:     p.stats.maxUsesClosed,
+		Discarded:         p.stats.discarded,
+		ResetFailures:     p.stats.resetFailures,
+		BreakerState:      p.breakerState(),
+		BreakerRejects:    p.stats.breakerRejects,
+		Leaked:            len(p.leaks(time.Now())),
+		LeakCount:         p.stats.leaks,
+		Adaptive:          p.adaptive,
+	}
 }
 
-func (pc *PooledConn) GetRedis() *redis.Client {
-	rc, ok := interface{}(pc.Conn).(*redis.Client)
-	if !ok {
-		panic("type assertion failed: " + reflect.ValueOf(pc.Conn).Type().String())
+// 借出超过LeakThreshold未归还的连接
+func (p *Pool[T]) Leaks() []LeakInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var infos []LeakInfo
+	for _, pc := range p.leaks(now) {
+		infos = append(infos, p.leakInfo(pc, now))
 	}
 
-	return rc
+	return infos
 }
 
-func (p *Pool) Stat() utils.MapStr {
-	return utils.MapStr{
-		"ID":          p.ID,
-		"idleCount":   p.idle.count,
-		"maxActive":   p.MaxActive,
-		"maxIdle":     p.MaxIdle,
-		"activeCount": p.active,
-		"id":          fmt.Sprintf("%v", &p),
+// 调用时须持有p.mu
+func (p *Pool[T]) leaks(now time.Time) []*PooledConn[T] {
+	if p.LeakThreshold <= 0 {
+		return nil
 	}
+	var leaked []*PooledConn[T]
+	for pc := range p.borrowed {
+		if pc.borrowedAt.Add(p.LeakThreshold).Before(now) {
+			leaked = append(leaked, pc)
+		}
+	}
+
+	return leaked
+}
+
+func (p *Pool[T]) leakInfo(pc *PooledConn[T], now time.Time) LeakInfo {
+	return LeakInfo{
+		PoolID:     p.ID,
+		BorrowedAt: pc.borrowedAt,
+		HeldFor:    now.Sub(pc.borrowedAt),
+		Stack:      string(pc.stack),
+	}
+}
+
+// 报告新发现的泄漏
+func (p *Pool[T]) detectLeaks() {
+	now := time.Now()
+	var infos []LeakInfo
+	p.mu.Lock()
+	for _, pc := range p.leaks(now) {
+		if pc.leakReported {
+			continue
+		}
+		pc.leakReported = true
+		p.stats.leaks++
+		infos = append(infos, p.leakInfo(pc, now))
+	}
+	p.mu.Unlock()
+	if p.OnLeak != nil {
+		for _, info := range infos {
+			p.OnLeak(info)
+		}
+	}
+}
+
+// 从池中获取连接
+func (p *Pool[T]) Get() (*PooledConn[T], error) {
+	return p.GetContext(context.Background())
 }
 
 // 从池中获取连接
-func (p *Pool) Get() (*PooledConn, error) {
+// 等待可用连接时，ctx取消或超时则放弃等待
+// 超时返回ErrPoolTimeout，取消返回ctx.Err()
+func (p *Pool[T]) GetContext(ctx context.Context) (*PooledConn[T], error) {
+	return p.GetPriority(ctx, PriorityNormal)
+}
+
+// 按优先级从池中获取连接
+// 等待名额时优先级高的调用方先获得名额，同优先级先到先得
+func (p *Pool[T]) GetPriority(ctx context.Context, priority int) (*PooledConn[T], error) {
+	var stack []byte
+	if p.LeakThreshold > 0 {
+		stack = debug.Stack()
+	}
+
+	return p.get(ctx, priority, stack)
+}
+
+// 获取连接，stack为开启泄漏检测时调用方的调用栈
+func (p *Pool[T]) get(ctx context.Context, priority int, stack []byte) (*PooledConn[T], error) {
 	// Handle limit for p.Wait == true.
-	if p.Wait && p.MaxActive > 0 {
-		p.lazyInit()
-		<-p.ch
+	slot, wait, err := p.acquire(ctx, priority)
+	if err != nil {
+		return nil, err
 	}
 
+	return p.borrow(ctx, slot, wait, stack)
+}
+
+// 不等待名额获取连接
+// p.Wait为true且没有名额时直接返回ErrPoolExhausted
+func (p *Pool[T]) tryGet(ctx context.Context, stack []byte) (*PooledConn[T], error) {
 	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	slot, ok := p.trySlot()
+	if !ok {
+		p.stats.exhausted++
+		p.mu.Unlock()
+		return nil, ErrPoolExhausted
+	}
+	p.mu.Unlock()
+
+	return p.borrow(ctx, slot, 0, stack)
+}
+
+// 借出空闲连接或新建连接，slot为是否已占用名额
+func (p *Pool[T]) borrow(ctx context.Context, slot bool, wait time.Duration, stack []byte) (*PooledConn[T], error) {
+	p.mu.Lock()
+	p.startMaintenance()
 
 	// Prune stale connections at the back of the idle list.
 	if p.IdleTimeout > 0 {
@@ -106,50 +385,142 @@ func (p *Pool) Get() (*PooledConn, error) {
 			pc := p.idle.back
 			p.idle.popBack()
 			p.mu.Unlock()
-			pc.Conn.Close()
+			p.closeConn(pc.Conn, CloseIdleTimeout)
 			p.mu.Lock()
 			p.active--
+			p.stats.idleTimeoutClosed++
 		}
 	}
 
-	// Get idle connection from the front of idle list.
-	for p.idle.front != nil {
-		pc := p.idle.front
-		p.idle.popFront()
+	// Get idle connection from the idle list.
+	if pc, err := p.borrowIdle(stack, slot); pc != nil || err != nil {
 		p.mu.Unlock()
-		return pc, nil
+		if pc != nil {
+			p.got(pc, wait)
+		}
+		return pc, err
 	}
 
 	// Check for pool closed before dialing a new connection.
 	if p.closed {
+		p.releaseSlot(slot)
 		p.mu.Unlock()
-		return nil, errors.New("get on closed pool")
+		return nil, ErrPoolClosed
 	}
 
 	// Handle limit for p.Wait == false.
 	if !p.Wait && p.MaxActive > 0 && p.active >= p.MaxActive {
+		p.stats.exhausted++
 		p.mu.Unlock()
 		return nil, ErrPoolExhausted
 	}
 
 	p.active++
 	p.mu.Unlock()
-	c, err := p.Dial()
+	c, err := p.dial(ctx)
+	p.mu.Lock()
 	if err != nil {
-		c = nil
+		p.active--
+		if _, ok := err.(*BreakerOpenError); !ok {
+			p.stats.dialFailures++
+		}
+		p.releaseSlot(slot)
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.stats.dials++
+	if p.closed {
+		// 新建连接期间连接池已关闭
+		p.active--
+		p.releaseSlot(slot)
+		p.mu.Unlock()
+		p.closeConn(c, ClosePoolClosed)
+		return nil, ErrPoolClosed
+	}
+	newPc := &PooledConn[T]{pool: p, Conn: c, createdAt: time.Now()}
+	p.checkout(newPc, stack, slot)
+	p.mu.Unlock()
+	p.got(newPc, wait)
+	return newPc, nil
+}
+
+// 借出空闲连接
+// 跳过超过存活时间和TestOnBorrow失败的连接，没有可用的空闲连接时返回nil
+// 调用时须持有p.mu，返回时仍持有p.mu
+func (p *Pool[T]) borrowIdle(stack []byte, slot bool) (*PooledConn[T], error) {
+	for p.idle.front != nil {
+		pc := p.popIdle()
+		expired := p.lifetimeExpired(pc, time.Now())
+		p.mu.Unlock()
+		if !expired && (p.TestOnBorrow == nil || p.TestOnBorrow(pc.Conn, pc.latestUsedAt) == nil) {
+			p.mu.Lock()
+			if p.closed {
+				// 检查期间连接池已关闭
+				p.active--
+				p.releaseSlot(slot)
+				p.mu.Unlock()
+				p.closeConn(pc.Conn, ClosePoolClosed)
+				p.mu.Lock()
+				return nil, ErrPoolClosed
+			}
+			p.stats.hits++
+			p.checkout(pc, stack, slot)
+			return pc, nil
+		}
+		if expired {
+			p.closeConn(pc.Conn, CloseMaxLifetime)
+		} else {
+			p.closeConn(pc.Conn, CloseBroken)
+		}
 		p.mu.Lock()
 		p.active--
-		if p.ch != nil && !p.closed {
-			p.ch <- struct{}{}
+		if expired {
+			p.stats.lifetimeClosed++
 		}
+	}
+
+	return nil, nil
+}
+
+// 不等待也不新建连接，仅尝试借出空闲连接
+// 没有空闲连接、没有名额或有调用方在等待时返回nil
+func (p *Pool[T]) tryIdle(stack []byte) *PooledConn[T] {
+	p.mu.Lock()
+	if p.closed || p.idle.front == nil {
 		p.mu.Unlock()
+		return nil
 	}
-	newPc := PooledConn{pool: p, Conn: c, createdAt: time.Now()}
-	return &newPc, err
+	slot, ok := p.trySlot()
+	if !ok {
+		p.mu.Unlock()
+		return nil
+	}
+	pc, err := p.borrowIdle(stack, slot)
+	if pc == nil && err == nil {
+		p.releaseSlot(slot)
+	}
+	p.mu.Unlock()
+	if pc != nil {
+		p.got(pc, 0)
+	}
+
+	return pc
+}
+
+// 获取连接并执行fn
+// fn返回或panic后都会归还连接
+func (p *Pool[T]) WithConn(ctx context.Context, fn func(pc *PooledConn[T]) error) error {
+	pc, err := p.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	return fn(pc)
 }
 
 // 关闭连接池
-func (p *Pool) Close() error {
+func (p *Pool[T]) Close() error {
 	p.mu.Lock()
 	if p.closed {
 		p.mu.Unlock()
@@ -160,71 +531,477 @@ func (p *Pool) Close() error {
 	pc := p.idle.front
 	p.idle.count = 0
 	p.idle.front, p.idle.back = nil, nil
-	if p.ch != nil {
-		close(p.ch)
+	// 唤醒等待中的调用方
+	p.grantWaiters()
+	stopped := p.stopped
+	if p.maintaining {
+		close(p.stop)
 	}
 	p.mu.Unlock()
 	for ; pc != nil; pc = pc.next {
-		pc.Conn.Close()
+		p.closeConn(pc.Conn, ClosePoolClosed)
+	}
+	// 等待维护协程退出
+	if stopped != nil {
+		<-stopped
 	}
 	return nil
 }
 
+// 预热连接池
+// 新建连接直到空闲连接数达到MinIdle，并启动维护协程（如已配置）
+func (p *Pool[T]) Warm(ctx context.Context) error {
+	p.mu.Lock()
+	p.startMaintenance()
+	p.mu.Unlock()
+
+	return p.fillIdle(ctx)
+}
+
+// 新建空闲连接直到达到MinIdle
+func (p *Pool[T]) fillIdle(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return ctxErr(err)
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return ErrPoolClosed
+		}
+		minIdle := p.MinIdle
+		if minIdle > p.MaxIdle {
+			minIdle = p.MaxIdle
+		}
+		if p.idle.count >= minIdle || (p.MaxActive > 0 && p.active >= p.MaxActive) {
+			p.mu.Unlock()
+			return nil
+		}
+		p.active++
+		p.mu.Unlock()
+
+		c, err := p.dial(ctx)
+		p.mu.Lock()
+		if err != nil {
+			p.active--
+			if _, ok := err.(*BreakerOpenError); !ok {
+				p.stats.dialFailures++
+			}
+			p.mu.Unlock()
+			return err
+		}
+		p.stats.dials++
+		if p.closed {
+			p.active--
+			p.mu.Unlock()
+			p.closeConn(c, ClosePoolClosed)
+			return ErrPoolClosed
+		}
+		now := time.Now()
+		p.idle.pushFront(&PooledConn[T]{pool: p, Conn: c, createdAt: now, latestUsedAt: now})
+		p.mu.Unlock()
+	}
+}
+
+// 优雅关闭连接池
+// 停止借出连接并关闭空闲连接，然后等待借出的连接全部归还
+// ctx结束时强制关闭仍未归还的连接，返回这些连接的信息和ctx的错误
+func (p *Pool[T]) Shutdown(ctx context.Context) ([]LeakInfo, error) {
+	p.Close()
+
+	p.mu.Lock()
+	if len(p.borrowed) == 0 {
+		p.mu.Unlock()
+		return nil, nil
+	}
+	if p.drained == nil {
+		p.drained = make(chan struct{})
+	}
+	drained := p.drained
+	p.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil, nil
+	case <-ctx.Done():
+	}
+
+	now := time.Now()
+	var forced []*PooledConn[T]
+	var infos []LeakInfo
+	p.mu.Lock()
+	for pc := range p.borrowed {
+		// 之后的Close返回ErrConnReturned
+		pc.returned = true
+		p.releaseSlot(pc.slot)
+		forced = append(forced, pc)
+		infos = append(infos, p.leakInfo(pc, now))
+	}
+	p.borrowed = nil
+	p.active -= len(forced)
+	p.mu.Unlock()
+	for _, pc := range forced {
+		p.closeConn(pc.Conn, CloseForced)
+	}
+
+	return infos, ctx.Err()
+}
+
 // 关闭池外连接 = 将连接归还
-func (pc *PooledConn) Close() error {
-	return pc.pool.put(pc)
+// 重复调用返回ErrConnReturned
+func (pc *PooledConn[T]) Close() error {
+	return pc.pool.put(pc, false)
+}
+
+// 关闭并丢弃连接，不再放回连接池
+// 用于连接已损坏的情况
+func (pc *PooledConn[T]) Discard() error {
+	return pc.pool.put(pc, true)
+}
+
+// 标记连接不可用，Close时将丢弃该连接
+func (pc *PooledConn[T]) MarkUnusable() {
+	pc.pool.mu.Lock()
+	pc.unusable = true
+	pc.pool.mu.Unlock()
+}
+
+// 记录借出的连接
+// 调用时须持有p.mu
+func (p *Pool[T]) checkout(pc *PooledConn[T], stack []byte, slot bool) {
+	if p.borrowed == nil {
+		p.borrowed = make(map[*PooledConn[T]]struct{})
+	}
+	pc.borrowedAt = time.Now()
+	pc.stack = stack
+	pc.leakReported = false
+	pc.slot = slot
+	pc.uses++
+	p.borrowed[pc] = struct{}{}
+}
+
+// 按IdleStrategy取出空闲连接
+// 空闲链表front为最近归还的连接，back为最早归还的连接
+// 调用时须持有p.mu
+func (p *Pool[T]) popIdle() *PooledConn[T] {
+	if p.IdleStrategy == FIFO {
+		pc := p.idle.back
+		p.idle.popBack()
+		return pc
+	}
+	pc := p.idle.front
+	p.idle.popFront()
+	return pc
 }
 
 // 归还连接
-func (p *Pool) put(pc *PooledConn) error {
+// discard为true时关闭连接
+func (p *Pool[T]) put(pc *PooledConn[T], discard bool) error {
 	p.mu.Lock()
-	if !p.closed {
-		// 最后使用时间
-		pc.latestUsedAt = time.Now()
+	if pc.returned {
+		p.mu.Unlock()
+		return ErrConnReturned
+	}
+	pc.returned = true
+	reset := p.OnReturn != nil && !discard && !pc.unusable && !p.closed
+	p.mu.Unlock()
+
+	// 重置连接状态，失败时丢弃连接
+	resetFailed := reset && p.reset(pc.Conn) != nil
+
+	p.mu.Lock()
+	if _, ok := p.borrowed[pc]; !ok {
+		// 重置期间已被Shutdown强制关闭
+		p.mu.Unlock()
+		return nil
+	}
+	slot := pc.slot
+	p.stats.returns++
+	p.stats.holdDuration += time.Since(pc.borrowedAt)
+	delete(p.borrowed, pc)
+	pc.stack = nil
+	if p.drained != nil && len(p.borrowed) == 0 {
+		// 通知Shutdown借出的连接已全部归还
+		close(p.drained)
+		p.drained = nil
+	}
+	conn := pc.Conn
+	var reason CloseReason
+	switch {
+	case p.closed:
+		// 连接池已关闭，关闭pc本身
+		reason = ClosePoolClosed
+	case resetFailed:
+		reason = CloseResetFailed
+		p.stats.resetFailures++
+	case discard || pc.unusable:
+		reason = CloseDiscarded
+		p.stats.discarded++
+	case p.lifetimeExpired(pc, time.Now()):
+		reason = CloseMaxLifetime
+		p.stats.lifetimeClosed++
+	case p.MaxUses > 0 && pc.uses >= p.MaxUses:
+		reason = CloseMaxUses
+		p.stats.maxUsesClosed++
+	default:
+		// 空闲链表中放入新的节点，已归还的pc不再可用
+		pc = &PooledConn[T]{
+			pool:         p,
+			Conn:         pc.Conn,
+			createdAt:    pc.createdAt,
+			latestUsedAt: time.Now(),
+			uses:         pc.uses,
+		}
 		p.idle.pushFront(pc)
 		if p.idle.count > p.MaxIdle {
 			pc = p.idle.back
 			p.idle.popBack()
+			reason = CloseMaxIdle
+			p.stats.maxIdleClosed++
+		} else if p.MaxActive > 0 && p.active > p.MaxActive {
+			// MaxActive调小后多出的连接
+			pc = p.idle.back
+			p.idle.popBack()
+			reason = CloseMaxActive
 		} else {
 			pc = nil
 		}
 	}
+	if pc != nil {
+		p.active--
+	}
+	p.releaseSlot(slot)
+	p.mu.Unlock()
+
+	if p.OnPut != nil {
+		p.OnPut(conn)
+	}
 	// 需要关闭多出连接
 	// 可能是pc本身（pool关闭时）
 	// 或idle尾部连接
 	if pc != nil {
-		pc.Conn.Close()
-		p.active--
-	}
-	if p.ch != nil && !p.closed {
-		p.ch <- struct{}{}
+		p.closeConn(pc.Conn, reason)
 	}
-	p.mu.Unlock()
 	return nil
 }
 
-func (p *Pool) lazyInit() {
-	// Fast path.
-	if atomic.LoadUint32(&p.chInitialized) == 1 {
+// 连接是否超过最长存活时间
+func (p *Pool[T]) lifetimeExpired(pc *PooledConn[T], now time.Time) bool {
+	return p.MaxConnLifetime > 0 && pc.createdAt.Add(p.MaxConnLifetime).Before(now)
+}
+
+// 连接是否空闲超时
+func (p *Pool[T]) idleExpired(pc *PooledConn[T], now time.Time) bool {
+	return p.IdleTimeout > 0 && pc.latestUsedAt.Add(p.IdleTimeout).Before(now)
+}
+
+// 启动后台维护协程
+// 调用时须持有p.mu
+func (p *Pool[T]) startMaintenance() {
+	if p.maintaining || p.closed || p.MaintenanceInterval <= 0 {
 		return
 	}
-	// Slow path.
+	p.maintaining = true
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	go p.maintain(p.MaintenanceInterval, p.stop, p.stopped)
+}
+
+// 维护协程
+// 定期清理过期的空闲连接、检测泄漏并补足空闲连接，直到stop被关闭
+func (p *Pool[T]) maintain(interval time.Duration, stop, stopped chan struct{}) {
+	defer close(stopped)
+	// stop关闭时取消补足空闲连接中的新建连接和重试退避，避免Close长时间阻塞
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.reap()
+			p.detectLeaks()
+			p.adapt()
+			p.fillIdle(ctx)
+		}
+	}
+}
+
+// 关闭空闲超时和超过存活时间的空闲连接
+func (p *Pool[T]) reap() {
+	var stale []closing[T]
+	now := time.Now()
 	p.mu.Lock()
-	if p.chInitialized == 0 {
-		p.ch = make(chan struct{}, p.MaxActive)
+	for pc := p.idle.back; pc != nil; {
+		prev := pc.prev
+		if p.idleExpired(pc, now) {
+			p.idle.remove(pc)
+			stale = append(stale, closing[T]{pc.Conn, CloseIdleTimeout})
+			p.stats.idleTimeoutClosed++
+		} else if p.lifetimeExpired(pc, now) {
+			p.idle.remove(pc)
+			stale = append(stale, closing[T]{pc.Conn, CloseMaxLifetime})
+			p.stats.lifetimeClosed++
+		}
+		pc = prev
+	}
+	p.active -= len(stale)
+	p.mu.Unlock()
+	for _, c := range stale {
+		p.closeConn(c.conn, c.reason)
+	}
+}
+
+// 将context错误转换为连接池错误
+func ctxErr(err error) error {
+	if err == context.DeadlineExceeded {
+		return ErrPoolTimeout
+	}
+	return err
+}
+
+// 占用名额
+// p.Wait为true时借出的连接都占用名额，MaxActive大于0时连接数受名额限制
+// 不限制时也计数，以便之后通过SetMaxActive设置上限时计入已借出的连接
+// 没有名额时进入等待队列，按优先级从高到低、同优先级先到先得获得名额
+// 返回是否占用了名额和等待时间
+func (p *Pool[T]) acquire(ctx context.Context, priority int) (slot bool, wait time.Duration, err error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return false, 0, ErrPoolClosed
+	}
+	if !p.Wait {
+		p.mu.Unlock()
+		return false, 0, nil
+	}
+	// 有人等待时排队，避免插队
+	if p.MaxActive <= 0 || (p.slots < p.MaxActive && len(p.waiters) == 0) {
+		p.slots++
+		p.mu.Unlock()
+		return true, 0, nil
+	}
+	p.waitSeq++
+	w := &waiter{priority: priority, seq: p.waitSeq, ready: make(chan struct{}, 1)}
+	p.waiters.push(w)
+	p.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+	}
+	wait = time.Since(start)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.waitCount++
+	p.stats.waitDuration += wait
+	if !w.granted {
+		p.waiters.remove(w)
 		if p.closed {
-			close(p.ch)
-		} else {
-			for i := 0; i < p.MaxActive; i++ {
-				p.ch <- struct{}{}
-			}
+			return false, wait, ErrPoolClosed
 		}
-		atomic.StoreUint32(&p.chInitialized, 1)
+		return false, wait, ctxErr(ctx.Err())
+	}
+	if err := ctx.Err(); err != nil {
+		// 获得名额的同时ctx已结束，让给下一个调用方
+		p.releaseSlot(w.slot)
+		return false, wait, ctxErr(err)
+	}
+
+	return w.slot, wait, nil
+}
+
+// 不等待地占用名额
+// 返回是否占用了名额，p.Wait为true时没有名额或有调用方在等待则ok为false
+// 调用时须持有p.mu
+func (p *Pool[T]) trySlot() (slot bool, ok bool) {
+	if !p.Wait {
+		return false, true
+	}
+	// 有人等待时不插队
+	if p.MaxActive > 0 && (p.slots >= p.MaxActive || len(p.waiters) > 0) {
+		return false, false
+	}
+	p.slots++
+
+	return true, true
+}
+
+// 释放名额
+// 调用时须持有p.mu
+func (p *Pool[T]) releaseSlot(slot bool) {
+	if !slot {
+		return
+	}
+	p.slots--
+	p.grantWaiters()
+}
+
+// 把空出的名额分配给等待中的调用方
+// 调用时须持有p.mu
+func (p *Pool[T]) grantWaiters() {
+	for len(p.waiters) > 0 {
+		if !p.closed && p.Wait && p.MaxActive > 0 && p.slots >= p.MaxActive {
+			return
+		}
+		w := p.waiters.pop()
+		// 连接池关闭时granted为false
+		w.granted = !p.closed
+		w.slot = w.granted && p.Wait
+		if w.slot {
+			p.slots++
+		}
+		w.ready <- struct{}{}
+	}
+}
+
+// 修改最大连接数
+// 调大时等待中的调用方立即获得名额，多出的空闲连接将被关闭
+func (p *Pool[T]) SetMaxActive(n int) {
+	p.mu.Lock()
+	p.MaxActive = n
+	p.grantWaiters()
+	var surplus []*PooledConn[T]
+	for n > 0 && p.active > n && p.idle.back != nil {
+		surplus = append(surplus, p.idle.back)
+		p.idle.popBack()
+		p.active--
 	}
 	p.mu.Unlock()
+	for _, pc := range surplus {
+		p.closeConn(pc.Conn, CloseMaxActive)
+	}
+}
+
+// 修改最大空闲连接数，多出的空闲连接将被关闭
+func (p *Pool[T]) SetMaxIdle(n int) {
+	p.mu.Lock()
+	p.MaxIdle = n
+	var surplus []*PooledConn[T]
+	for p.idle.count > n && p.idle.back != nil {
+		surplus = append(surplus, p.idle.back)
+		p.idle.popBack()
+		p.active--
+		p.stats.maxIdleClosed++
+	}
+	p.mu.Unlock()
+	for _, pc := range surplus {
+		p.closeConn(pc.Conn, CloseMaxIdle)
+	}
 }
 
-func (l *idleList) pushFront(pc *PooledConn) {
+func (l *idleList[T]) pushFront(pc *PooledConn[T]) {
 	pc.next = l.front
 	pc.prev = nil
 	if l.count == 0 {
@@ -237,7 +1014,7 @@ func (l *idleList) pushFront(pc *PooledConn) {
 	return
 }
 
-func (l *idleList) popFront() {
+func (l *idleList[T]) popFront() {
 	pc := l.front
 	l.count--
 	if l.count == 0 {
@@ -249,7 +1026,22 @@ func (l *idleList) popFront() {
 	pc.next, pc.prev = nil, nil
 }
 
-func (l *idleList) popBack() {
+func (l *idleList[T]) remove(pc *PooledConn[T]) {
+	if pc == l.front {
+		l.popFront()
+		return
+	}
+	if pc == l.back {
+		l.popBack()
+		return
+	}
+	pc.prev.next = pc.next
+	pc.next.prev = pc.prev
+	pc.next, pc.prev = nil, nil
+	l.count--
+}
+
+func (l *idleList[T]) popBack() {
 	pc := l.back
 	l.count--
 	if l.count == 0 {
@@ -0,0 +1,506 @@
+package ignition
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testConn struct {
+	closed int32
+}
+
+func (c *testConn) Close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return nil
+}
+
+func newTestPool(maxActive, maxIdle int) *Pool[*testConn] {
+	return &Pool[*testConn]{
+		MaxActive: maxActive,
+		MaxIdle:   maxIdle,
+		Wait:      true,
+		Dial: func() (*testConn, error) {
+			return &testConn{}, nil
+		},
+	}
+}
+
+func TestPoolGetContext(t *testing.T) {
+	p := newTestPool(1, 1)
+	defer p.Close()
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = p.GetContext(ctx)
+	assert.Equal(t, ErrPoolTimeout, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = p.GetContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	// the abandoned waits must not leak slots
+	assert.Equal(t, 1, p.active)
+	assert.Nil(t, pc.Close())
+	pc, err = p.GetContext(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, 1, p.active)
+	assert.Equal(t, 1, p.idle.count)
+}
+
+func TestPoolMaintenance(t *testing.T) {
+	p := newTestPool(3, 3)
+	p.IdleTimeout = 30 * time.Millisecond
+	p.MaxConnLifetime = time.Hour
+	p.MaintenanceInterval = 10 * time.Millisecond
+
+	var conns []*PooledConn[*testConn]
+	for i := 0; i < 3; i++ {
+		pc, err := p.Get()
+		assert.Nil(t, err)
+		conns = append(conns, pc)
+	}
+	for _, pc := range conns {
+		assert.Nil(t, pc.Close())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	p.mu.Lock()
+	assert.Equal(t, 0, p.idle.count)
+	assert.Equal(t, 0, p.active)
+	p.mu.Unlock()
+	for _, pc := range conns {
+		assert.Equal(t, int32(1), atomic.LoadInt32(&pc.Conn.closed))
+	}
+
+	assert.Nil(t, p.Close())
+	select {
+	case <-p.stopped:
+	default:
+		t.Error("maintenance goroutine is still running")
+	}
+
+	// connections older than MaxConnLifetime are retired
+	p = newTestPool(3, 3)
+	p.MaxConnLifetime = 30 * time.Millisecond
+	p.MaintenanceInterval = 10 * time.Millisecond
+	defer p.Close()
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&pc.Conn.closed))
+}
+
+func TestPoolTestOnBorrow(t *testing.T) {
+	p := newTestPool(2, 2)
+	defer p.Close()
+	broken := map[*testConn]bool{}
+	p.TestOnBorrow = func(conn *testConn, idleSince time.Time) error {
+		if broken[conn] {
+			return errors.New("broken")
+		}
+		return nil
+	}
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	bad := pc.Conn
+	assert.Nil(t, pc.Close())
+	broken[bad] = true
+
+	pc, err = p.Get()
+	assert.Nil(t, err)
+	assert.NotEqual(t, bad, pc.Conn)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&bad.closed))
+	assert.Equal(t, 1, p.active)
+	assert.Nil(t, pc.Close())
+}
+
+func TestPoolStats(t *testing.T) {
+	p := newTestPool(2, 1)
+	defer p.Close()
+
+	pc1, err := p.Get()
+	assert.Nil(t, err)
+	pc2, err := p.Get()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = p.GetContext(ctx)
+	assert.Equal(t, ErrPoolTimeout, err)
+
+	assert.Nil(t, pc1.Close())
+	// exceeds MaxIdle
+	assert.Nil(t, pc2.Close())
+	pc1, err = p.Get()
+	assert.Nil(t, err)
+
+	s := p.Stats()
+	assert.Equal(t, 1, s.ActiveCount)
+	assert.Equal(t, 0, s.IdleCount)
+	assert.Equal(t, 1, s.InUse)
+	assert.Equal(t, int64(1), s.WaitCount)
+	assert.True(t, s.WaitDuration >= 20*time.Millisecond)
+	assert.Equal(t, int64(2), s.Dials)
+	assert.Equal(t, int64(1), s.Hits)
+	assert.Equal(t, int64(1), s.MaxIdleClosed)
+	assert.Nil(t, pc1.Close())
+}
+
+func TestPoolLeakDetection(t *testing.T) {
+	p := newTestPool(2, 2)
+	p.LeakThreshold = 20 * time.Millisecond
+	p.MaintenanceInterval = 10 * time.Millisecond
+	leaks := make(chan LeakInfo, 2)
+	p.OnLeak = func(info LeakInfo) {
+		leaks <- info
+	}
+	defer p.Close()
+
+	returned, err := p.Get()
+	assert.Nil(t, err)
+	_, err = p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, returned.Close())
+
+	select {
+	case info := <-leaks:
+		assert.True(t, info.HeldFor >= p.LeakThreshold)
+		assert.Contains(t, info.Stack, "TestPoolLeakDetection")
+	case <-time.After(time.Second):
+		t.Fatal("leak not reported")
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, leaks, 0)
+
+	s := p.Stats()
+	assert.Equal(t, 1, s.Leaked)
+	assert.Equal(t, int64(1), s.LeakCount)
+	assert.Len(t, p.Leaks(), 1)
+}
+
+func TestPoolDiscard(t *testing.T) {
+	p := newTestPool(2, 2)
+	defer p.Close()
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Discard())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&pc.Conn.closed))
+	assert.Equal(t, ErrConnReturned, pc.Close())
+
+	pc, err = p.Get()
+	assert.Nil(t, err)
+	pc.MarkUnusable()
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&pc.Conn.closed))
+
+	s := p.Stats()
+	assert.Equal(t, 0, s.ActiveCount)
+	assert.Equal(t, 0, s.IdleCount)
+	assert.Equal(t, int64(2), s.Discarded)
+}
+
+func TestPoolDoubleClose(t *testing.T) {
+	p := newTestPool(2, 2)
+	defer p.Close()
+
+	pc1, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc1.Close())
+	assert.Equal(t, ErrConnReturned, pc1.Close())
+	assert.Equal(t, 1, p.Stats().IdleCount)
+
+	// a stale handle must not return a connection borrowed by someone else
+	pc2, err := p.Get()
+	assert.Nil(t, err)
+	assert.Same(t, pc1.Conn, pc2.Conn)
+	assert.Equal(t, ErrConnReturned, pc1.Close())
+	s := p.Stats()
+	assert.Equal(t, 0, s.IdleCount)
+	assert.Equal(t, 1, s.InUse)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&pc2.Conn.closed))
+	assert.Nil(t, pc2.Close())
+	assert.Equal(t, 1, p.Stats().IdleCount)
+	assert.Equal(t, 1, p.Stats().ActiveCount)
+}
+
+func TestPoolShutdown(t *testing.T) {
+	p := newTestPool(3, 3)
+	pc1, err := p.Get()
+	assert.Nil(t, err)
+	pc2, err := p.Get()
+	assert.Nil(t, err)
+	idle, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, idle.Close())
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pc1.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	forced, err := p.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Len(t, forced, 1)
+
+	_, err = p.Get()
+	assert.Equal(t, ErrPoolClosed, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&pc1.Conn.closed))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&pc2.Conn.closed))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&idle.Conn.closed))
+	assert.Equal(t, ErrConnReturned, pc2.Close())
+	assert.Equal(t, 0, p.Stats().ActiveCount)
+
+	// all connections returned in time
+	p = newTestPool(3, 3)
+	pc1, err = p.Get()
+	assert.Nil(t, err)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pc1.Close()
+	}()
+	forced, err = p.Shutdown(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, forced, 0)
+	assert.Equal(t, 0, p.Stats().ActiveCount)
+}
+
+func TestPoolWarm(t *testing.T) {
+	p := newTestPool(3, 5)
+	p.MinIdle = 5
+	defer p.Close()
+
+	assert.Nil(t, p.Warm(context.Background()))
+	s := p.Stats()
+	// limited by MaxActive
+	assert.Equal(t, 3, s.IdleCount)
+	assert.Equal(t, 3, s.ActiveCount)
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), p.Stats().Hits)
+	assert.Nil(t, pc.Close())
+
+	// the maintenance loop tops up idle connections
+	p = newTestPool(3, 2)
+	p.MinIdle = 2
+	p.MaintenanceInterval = 10 * time.Millisecond
+	defer p.Close()
+	assert.Nil(t, p.Warm(context.Background()))
+	pc1, err := p.Get()
+	assert.Nil(t, err)
+	pc2, err := p.Get()
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+	s = p.Stats()
+	assert.Equal(t, 1, s.IdleCount)
+	assert.Equal(t, 3, s.ActiveCount)
+	assert.Nil(t, pc1.Close())
+	assert.Nil(t, pc2.Close())
+}
+
+func TestPoolCloseDuringFillIdle(t *testing.T) {
+	dialing := make(chan struct{}, 1)
+	p := newTestPool(3, 2)
+	p.MinIdle = 2
+	p.MaintenanceInterval = 10 * time.Millisecond
+	p.DialRetries = 5
+	p.DialBackoff = time.Hour
+	p.Dial = func() (*testConn, error) {
+		select {
+		case dialing <- struct{}{}:
+		default:
+		}
+		return nil, errors.New("dial failed")
+	}
+	p.mu.Lock()
+	p.startMaintenance()
+	p.mu.Unlock()
+
+	// wait until the maintenance loop is backing off between retries
+	select {
+	case <-dialing:
+	case <-time.After(time.Second):
+		t.Fatal("maintenance did not dial")
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on the dial backoff")
+	}
+	assert.Equal(t, 0, p.Stats().ActiveCount)
+}
+
+func TestPoolSetMaxActive(t *testing.T) {
+	p := newTestPool(1, 2)
+	defer p.Close()
+
+	pc1, err := p.Get()
+	assert.Nil(t, err)
+
+	// growing the limit wakes up waiters
+	got := make(chan *PooledConn[*testConn])
+	go func() {
+		pc, err := p.Get()
+		assert.Nil(t, err)
+		got <- pc
+	}()
+	time.Sleep(20 * time.Millisecond)
+	p.SetMaxActive(2)
+	var pc2 *PooledConn[*testConn]
+	select {
+	case pc2 = <-got:
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken up")
+	}
+
+	// shrinking the limit blocks until enough connections are returned
+	p.SetMaxActive(1)
+	assert.Nil(t, pc1.Close())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = p.GetContext(ctx)
+	assert.Equal(t, ErrPoolTimeout, err)
+	assert.Nil(t, pc2.Close())
+	// surplus idle connections are closed
+	assert.Equal(t, 1, p.Stats().IdleCount)
+
+	pc1, err = p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc1.Close())
+}
+
+func TestPoolSetMaxActiveFromUnlimited(t *testing.T) {
+	p := newTestPool(0, 4)
+	defer p.Close()
+
+	var pcs []*PooledConn[*testConn]
+	for i := 0; i < 4; i++ {
+		pc, err := p.Get()
+		assert.Nil(t, err)
+		pcs = append(pcs, pc)
+	}
+
+	// connections borrowed while unlimited count against the new limit
+	p.SetMaxActive(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := p.GetContext(ctx)
+	assert.Equal(t, ErrPoolTimeout, err)
+
+	for _, pc := range pcs[:3] {
+		assert.Nil(t, pc.Close())
+	}
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, p.Stats().InUse)
+	assert.Nil(t, pc.Close())
+	assert.Nil(t, pcs[3].Close())
+}
+
+func TestPoolSetMaxIdle(t *testing.T) {
+	p := newTestPool(3, 3)
+	defer p.Close()
+
+	var conns []*PooledConn[*testConn]
+	for i := 0; i < 3; i++ {
+		pc, err := p.Get()
+		assert.Nil(t, err)
+		conns = append(conns, pc)
+	}
+	for _, pc := range conns {
+		assert.Nil(t, pc.Close())
+	}
+	p.SetMaxIdle(1)
+	s := p.Stats()
+	assert.Equal(t, 1, s.IdleCount)
+	assert.Equal(t, 1, s.ActiveCount)
+	assert.Equal(t, int64(2), s.MaxIdleClosed)
+}
+
+func TestPoolWithConn(t *testing.T) {
+	p := newTestPool(1, 1)
+	defer p.Close()
+
+	fail := errors.New("query failed")
+	err := p.WithConn(context.Background(), func(pc *PooledConn[*testConn]) error {
+		return fail
+	})
+	assert.Equal(t, fail, err)
+	assert.Equal(t, 0, p.Stats().InUse)
+
+	assert.Panics(t, func() {
+		p.WithConn(context.Background(), func(pc *PooledConn[*testConn]) error {
+			panic("boom")
+		})
+	})
+	s := p.Stats()
+	assert.Equal(t, 0, s.InUse)
+	assert.Equal(t, 1, s.IdleCount)
+}
+
+func TestPoolMaxUses(t *testing.T) {
+	p := newTestPool(1, 1)
+	p.MaxUses = 2
+	defer p.Close()
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	first := pc.Conn
+	assert.Nil(t, pc.Close())
+	pc, err = p.Get()
+	assert.Nil(t, err)
+	assert.Same(t, first, pc.Conn)
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&first.closed))
+
+	pc, err = p.Get()
+	assert.Nil(t, err)
+	assert.NotSame(t, first, pc.Conn)
+	assert.Nil(t, pc.Close())
+	assert.Equal(t, int64(1), p.Stats().MaxUsesClosed)
+	assert.Equal(t, int64(2), p.Stats().Dials)
+}
+
+func TestPoolIdleStrategy(t *testing.T) {
+	for _, strategy := range []IdleStrategy{LIFO, FIFO} {
+		p := newTestPool(2, 2)
+		p.IdleStrategy = strategy
+
+		pc1, err := p.Get()
+		assert.Nil(t, err)
+		pc2, err := p.Get()
+		assert.Nil(t, err)
+		assert.Nil(t, pc1.Close())
+		assert.Nil(t, pc2.Close())
+
+		pc, err := p.Get()
+		assert.Nil(t, err)
+		if strategy == LIFO {
+			assert.Same(t, pc2.Conn, pc.Conn)
+		} else {
+			assert.Same(t, pc1.Conn, pc.Conn)
+		}
+		assert.Nil(t, pc.Close())
+		assert.Nil(t, p.Close())
+	}
+}
@@ -0,0 +1,77 @@
+// redis连接池适配
+package redispool
+
+import (
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/limen/ignition"
+	"net"
+	"strconv"
+	"time"
+)
+
+// redis连接池
+type Pool = ignition.Pool[*redis.Client]
+
+// 池中redis连接
+type PooledConn = ignition.PooledConn[*redis.Client]
+
+// 创建redis连接的Dial函数
+// 新建的连接会先ping一次，失败则关闭并返回错误
+func Dial(opt *redis.Options) func() (*redis.Client, error) {
+	return func() (*redis.Client, error) {
+		rc := redis.NewClient(opt)
+		if err := rc.Ping().Err(); err != nil {
+			rc.Close()
+			return nil, err
+		}
+
+		return rc, nil
+	}
+}
+
+// 借出前ping连接，用作Pool.TestOnBorrow
+func Ping(rc *redis.Client, idleSince time.Time) error {
+	return rc.Ping().Err()
+}
+
+// 按配置创建redis连接池的驱动
+// 配置中的database为redis db编号，dsn为redis://格式的URL
+//
+//	ignition.RegisterDriver("redis", redispool.Driver())
+func Driver() ignition.Driver {
+	dial := func(conf ignition.PoolConfig) (*redis.Client, error) {
+		opt, err := Options(conf)
+		if err != nil {
+			return nil, err
+		}
+		return Dial(opt)()
+	}
+	setup := func(p *Pool, conf ignition.PoolConfig) {
+		if conf.TestOnBorrow {
+			p.TestOnBorrow = Ping
+		}
+	}
+
+	return ignition.NewDriver(dial, setup)
+}
+
+// 由配置生成redis.Options
+func Options(conf ignition.PoolConfig) (*redis.Options, error) {
+	if conf.DSN != "" {
+		return redis.ParseURL(conf.DSN)
+	}
+	opt := &redis.Options{
+		Addr:     net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)),
+		Password: conf.Password,
+	}
+	if conf.Database != "" {
+		db, err := strconv.Atoi(conf.Database)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", conf.Database)
+		}
+		opt.DB = db
+	}
+
+	return opt, nil
+}
@@ -0,0 +1,243 @@
+package ignition
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 连接池配置，通常来自YAML、JSON、TOML等格式的配置文件
+//
+//	pools:
+//	  primary:
+//	    driver: postgres
+//	    host: 127.0.0.1
+//	    port: 5432
+//	    user: ignition
+//	    password: secret
+//	    database: ignition
+//	    options:
+//	      sslmode: disable
+//	    max_active: 10
+//	    max_idle: 2
+//	    idle_timeout: 5m
+type PoolConfig struct {
+	// 驱动名，须先通过RegisterDriver注册
+	Driver string `yaml:"driver" json:"driver" toml:"driver"`
+	// 完整的连接串，设置后忽略Host等字段
+	DSN      string            `yaml:"dsn" json:"dsn" toml:"dsn"`
+	Host     string            `yaml:"host" json:"host" toml:"host"`
+	Port     int               `yaml:"port" json:"port" toml:"port"`
+	User     string            `yaml:"user" json:"user" toml:"user"`
+	Password string            `yaml:"password" json:"password" toml:"password"`
+	Database string            `yaml:"database" json:"database" toml:"database"`
+	Options  map[string]string `yaml:"options" json:"options" toml:"options"`
+
+	MaxActive           int           `yaml:"max_active" json:"max_active" toml:"max_active"`
+	MaxIdle             int           `yaml:"max_idle" json:"max_idle" toml:"max_idle"`
+	MinIdle             int           `yaml:"min_idle" json:"min_idle" toml:"min_idle"`
+	Wait                bool          `yaml:"wait" json:"wait" toml:"wait"`
+	IdleTimeout         time.Duration `yaml:"idle_timeout" json:"idle_timeout" toml:"idle_timeout"`
+	MaxConnLifetime     time.Duration `yaml:"max_conn_lifetime" json:"max_conn_lifetime" toml:"max_conn_lifetime"`
+	MaxUses             int           `yaml:"max_uses" json:"max_uses" toml:"max_uses"`
+	MaintenanceInterval time.Duration `yaml:"maintenance_interval" json:"maintenance_interval" toml:"maintenance_interval"`
+	TestOnBorrow        bool          `yaml:"test_on_borrow" json:"test_on_borrow" toml:"test_on_borrow"`
+	DialRetries         int           `yaml:"dial_retries" json:"dial_retries" toml:"dial_retries"`
+	DialBackoff         time.Duration `yaml:"dial_backoff" json:"dial_backoff" toml:"dial_backoff"`
+	DialMaxBackoff      time.Duration `yaml:"dial_max_backoff" json:"dial_max_backoff" toml:"dial_max_backoff"`
+	BreakerThreshold    int           `yaml:"breaker_threshold" json:"breaker_threshold" toml:"breaker_threshold"`
+	BreakerCooldown     time.Duration `yaml:"breaker_cooldown" json:"breaker_cooldown" toml:"breaker_cooldown"`
+}
+
+// 由注册表统一管理的连接池
+// 所有*Pool[T]都实现了该接口
+type ManagedPool interface {
+	Stats() PoolStats
+	Warm(ctx context.Context) error
+	Close() error
+	Shutdown(ctx context.Context) ([]LeakInfo, error)
+}
+
+// 驱动，根据配置创建连接池
+type Driver func(id string, conf PoolConfig) (ManagedPool, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{}
+)
+
+// 注册驱动
+// 同名驱动会被覆盖
+func RegisterDriver(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	drivers[name] = driver
+}
+
+// 由Dial函数构造驱动
+// setup用于按配置做额外设置，如TestOnBorrow
+func NewDriver[T Conn](dial func(conf PoolConfig) (T, error), setup ...func(p *Pool[T], conf PoolConfig)) Driver {
+	return func(id string, conf PoolConfig) (ManagedPool, error) {
+		p := &Pool[T]{
+			ID: id,
+			Dial: func() (T, error) {
+				return dial(conf)
+			},
+			MaxActive:           conf.MaxActive,
+			MaxIdle:             conf.MaxIdle,
+			MinIdle:             conf.MinIdle,
+			Wait:                conf.Wait,
+			IdleTimeout:         conf.IdleTimeout,
+			MaxConnLifetime:     conf.MaxConnLifetime,
+			MaxUses:             conf.MaxUses,
+			MaintenanceInterval: conf.MaintenanceInterval,
+			DialRetries:         conf.DialRetries,
+			DialBackoff:         conf.DialBackoff,
+			DialMaxBackoff:      conf.DialMaxBackoff,
+			BreakerThreshold:    conf.BreakerThreshold,
+			BreakerCooldown:     conf.BreakerCooldown,
+		}
+		for _, f := range setup {
+			f(p, conf)
+		}
+
+		return p, nil
+	}
+}
+
+// 连接池注册表
+type Registry struct {
+	mu    sync.RWMutex
+	pools map[string]ManagedPool
+}
+
+// 按配置创建所有连接池
+// 任一连接池创建失败时，关闭已创建的连接池并返回错误
+func NewRegistry(confs map[string]PoolConfig) (*Registry, error) {
+	r := &Registry{pools: map[string]ManagedPool{}}
+	for name, conf := range confs {
+		driversMu.RLock()
+		driver, ok := drivers[conf.Driver]
+		driversMu.RUnlock()
+		if !ok {
+			r.Close()
+			return nil, fmt.Errorf("pool %s: unknown driver %q", name, conf.Driver)
+		}
+		p, err := driver(name, conf)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("pool %s: %v", name, err)
+		}
+		r.pools[name] = p
+	}
+
+	return r, nil
+}
+
+// 添加连接池
+func (r *Registry) Add(name string, p ManagedPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pools == nil {
+		r.pools = map[string]ManagedPool{}
+	}
+	r.pools[name] = p
+}
+
+// 获取连接池
+func (r *Registry) Get(name string) (ManagedPool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.pools[name]
+	if !ok {
+		return nil, fmt.Errorf("pool %s not found", name)
+	}
+
+	return p, nil
+}
+
+// 所有连接池的名称
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.pools))
+	for name := range r.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// 获取指定连接类型的连接池
+func GetPool[T Conn](r *Registry, name string) (*Pool[T], error) {
+	mp, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := mp.(*Pool[T])
+	if !ok {
+		return nil, fmt.Errorf("pool %s is %T, not %T", name, mp, p)
+	}
+
+	return p, nil
+}
+
+// 预热所有连接池
+func (r *Registry) Warm(ctx context.Context) error {
+	for _, name := range r.Names() {
+		p, _ := r.Get(name)
+		if err := p.Warm(ctx); err != nil {
+			return fmt.Errorf("pool %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// 关闭所有连接池
+func (r *Registry) Close() error {
+	var firstErr error
+	for _, name := range r.Names() {
+		p, _ := r.Get(name)
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// 优雅关闭所有连接池
+// 返回各连接池被强制关闭的连接
+func (r *Registry) Shutdown(ctx context.Context) (map[string][]LeakInfo, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	forced := map[string][]LeakInfo{}
+	for _, name := range r.Names() {
+		p, _ := r.Get(name)
+		wg.Add(1)
+		go func(name string, p ManagedPool) {
+			defer wg.Done()
+			infos, err := p.Shutdown(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			if len(infos) > 0 {
+				forced[name] = infos
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(name, p)
+	}
+	wg.Wait()
+
+	return forced, firstErr
+}
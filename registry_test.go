@@ -0,0 +1,72 @@
+package ignition
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"testing"
+	"time"
+)
+
+type registryConf struct {
+	Pools map[string]PoolConfig `yaml:"pools"`
+}
+
+const registryYAML = `
+pools:
+  primary:
+    driver: test
+    host: 127.0.0.1
+    port: 5432
+    max_active: 5
+    max_idle: 2
+    min_idle: 1
+    wait: true
+    idle_timeout: 5m
+  cache:
+    driver: test
+    max_active: 1
+`
+
+func TestRegistry(t *testing.T) {
+	var dialed []PoolConfig
+	RegisterDriver("test", NewDriver(func(conf PoolConfig) (*testConn, error) {
+		dialed = append(dialed, conf)
+		return &testConn{}, nil
+	}))
+
+	conf := registryConf{}
+	assert.Nil(t, yaml.Unmarshal([]byte(registryYAML), &conf))
+	r, err := NewRegistry(conf.Pools)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cache", "primary"}, r.Names())
+
+	p, err := GetPool[*testConn](r, "primary")
+	assert.Nil(t, err)
+	assert.Equal(t, "primary", p.ID)
+	assert.Equal(t, 5, p.MaxActive)
+	assert.Equal(t, 2, p.MaxIdle)
+	assert.True(t, p.Wait)
+	assert.Equal(t, 5*time.Minute, p.IdleTimeout)
+
+	assert.Nil(t, r.Warm(context.Background()))
+	assert.Len(t, dialed, 1)
+	assert.Equal(t, "127.0.0.1", dialed[0].Host)
+	pc, err := p.Get()
+	assert.Nil(t, err)
+	assert.Nil(t, pc.Close())
+
+	_, err = r.Get("missing")
+	assert.Error(t, err)
+	_, err = GetPool[*otherConn](r, "primary")
+	assert.Error(t, err)
+
+	assert.Nil(t, r.Close())
+	_, err = p.Get()
+	assert.Equal(t, ErrPoolClosed, err)
+
+	_, err = NewRegistry(map[string]PoolConfig{"x": {Driver: "unknown"}})
+	assert.Error(t, err)
+}
+
+type otherConn struct{ testConn }
@@ -0,0 +1,157 @@
+package ignition
+
+import (
+	"context"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// 分片连接池
+// 连接分散在多个子连接池中，降低高并发下单个锁的竞争
+// 获取连接时轮询选择分片，该分片没有空闲连接时从其他分片窃取，都没有时由该分片等待或新建连接
+type ShardedPool[T Conn] struct {
+	ID     string
+	Shards []*Pool[T]
+
+	next uint32 // 轮询位置
+}
+
+// 创建分片连接池
+// newShard创建第i个分片，MaxActive等限制按分片分别生效
+func NewShardedPool[T Conn](id string, n int, newShard func(i int) *Pool[T]) *ShardedPool[T] {
+	if n <= 0 {
+		n = 1
+	}
+	s := &ShardedPool[T]{ID: id, Shards: make([]*Pool[T], n)}
+	for i := range s.Shards {
+		s.Shards[i] = newShard(i)
+	}
+
+	return s
+}
+
+// 从池中获取连接
+func (s *ShardedPool[T]) Get() (*PooledConn[T], error) {
+	return s.GetContext(context.Background())
+}
+
+// 从池中获取连接
+func (s *ShardedPool[T]) GetContext(ctx context.Context) (*PooledConn[T], error) {
+	return s.GetPriority(ctx, PriorityNormal)
+}
+
+// 按优先级从池中获取连接
+// 连接归还到借出它的分片
+func (s *ShardedPool[T]) GetPriority(ctx context.Context, priority int) (*PooledConn[T], error) {
+	n := uint32(len(s.Shards))
+	home := atomic.AddUint32(&s.next, 1) % n
+	// 调用栈只记录一次，供所有分片使用
+	var stack []byte
+	for _, p := range s.Shards {
+		if p.LeakThreshold > 0 {
+			stack = debug.Stack()
+			break
+		}
+	}
+	for i := uint32(0); i < n; i++ {
+		p := s.Shards[(home+i)%n]
+		if pc := p.tryIdle(stack); pc != nil {
+			return pc, nil
+		}
+	}
+
+	return s.Shards[home].get(ctx, priority, stack)
+}
+
+// 获取连接并执行fn
+// fn返回或panic后都会归还连接
+func (s *ShardedPool[T]) WithConn(ctx context.Context, fn func(pc *PooledConn[T]) error) error {
+	pc, err := s.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	return fn(pc)
+}
+
+// 汇总各分片的统计
+// 熔断器状态取最严重的分片
+func (s *ShardedPool[T]) Stats() PoolStats {
+	total := PoolStats{ID: s.ID, BreakerState: BreakerClosed}
+	for _, p := range s.Shards {
+		st := p.Stats()
+		total.MaxActive += st.MaxActive
+		total.MaxIdle += st.MaxIdle
+		total.ActiveCount += st.ActiveCount
+		total.IdleCount += st.IdleCount
+		total.InUse += st.InUse
+		total.Waiting += st.Waiting
+		total.WaitCount += st.WaitCount
+		total.WaitDuration += st.WaitDuration
+		total.Hits += st.Hits
+		total.Dials += st.Dials
+		total.DialFailures += st.DialFailures
+		total.Exhausted += st.Exhausted
+		total.MaxIdleClosed += st.MaxIdleClosed
+		total.IdleTimeoutClosed += st.IdleTimeoutClosed
+		total.LifetimeClosed += st.LifetimeClosed
+		total.MaxUsesClosed += st.MaxUsesClosed
+		total.Discarded += st.Discarded
+		total.ResetFailures += st.ResetFailures
+		total.BreakerRejects += st.BreakerRejects
+		total.Leaked += st.Leaked
+		total.LeakCount += st.LeakCount
+		switch st.BreakerState {
+		case BreakerOpen:
+			total.BreakerState = BreakerOpen
+		case BreakerHalfOpen:
+			if total.BreakerState == BreakerClosed {
+				total.BreakerState = BreakerHalfOpen
+			}
+		}
+	}
+
+	return total
+}
+
+// 预热所有分片
+func (s *ShardedPool[T]) Warm(ctx context.Context) error {
+	for _, p := range s.Shards {
+		if err := p.Warm(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 关闭所有分片
+func (s *ShardedPool[T]) Close() error {
+	var firstErr error
+	for _, p := range s.Shards {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// 优雅关闭所有分片
+// 先停止所有分片借出连接，再逐个等待借出的连接归还
+func (s *ShardedPool[T]) Shutdown(ctx context.Context) ([]LeakInfo, error) {
+	s.Close()
+
+	var forced []LeakInfo
+	var firstErr error
+	for _, p := range s.Shards {
+		infos, err := p.Shutdown(ctx)
+		forced = append(forced, infos...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return forced, firstErr
+}
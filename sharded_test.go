@@ -0,0 +1,66 @@
+package ignition
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newTestShardedPool(shards, maxActive, maxIdle int) *ShardedPool[*testConn] {
+	return NewShardedPool("sharded", shards, func(i int) *Pool[*testConn] {
+		return newTestPool(maxActive, maxIdle)
+	})
+}
+
+func TestShardedPoolSteal(t *testing.T) {
+	s := newTestShardedPool(4, 2, 2)
+	defer s.Close()
+
+	// only one shard holds an idle connection
+	pc, err := s.Shards[2].Get()
+	assert.Nil(t, err)
+	conn := pc.Conn
+	assert.Nil(t, pc.Close())
+
+	for i := 0; i < 4; i++ {
+		pc, err = s.Get()
+		assert.Nil(t, err)
+		assert.Same(t, conn, pc.Conn)
+		assert.Same(t, s.Shards[2], pc.pool)
+		// stolen from shard 2 rather than dialed by the home shard
+		assert.Equal(t, 0, s.Shards[2].Stats().IdleCount)
+		assert.Equal(t, int64(1), s.Stats().Dials)
+		assert.Nil(t, pc.Close())
+	}
+
+	stats := s.Stats()
+	assert.Equal(t, "sharded", stats.ID)
+	assert.Equal(t, 8, stats.MaxActive)
+	assert.Equal(t, 1, stats.ActiveCount)
+	assert.Equal(t, 1, stats.IdleCount)
+	assert.Equal(t, int64(1), stats.Dials)
+	assert.Equal(t, int64(4), stats.Hits)
+}
+
+func TestShardedPoolFallback(t *testing.T) {
+	s := newTestShardedPool(2, 1, 1)
+
+	// all shards busy: a new Get waits on its own shard
+	pc1, err := s.Get()
+	assert.Nil(t, err)
+	pc2, err := s.Get()
+	assert.Nil(t, err)
+	assert.NotSame(t, pc1.pool, pc2.pool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.GetContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	assert.Nil(t, pc1.Close())
+	forced, err := s.Shutdown(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, forced, 1)
+	_, err = s.Get()
+	assert.Equal(t, ErrPoolClosed, err)
+}
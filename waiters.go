@@ -0,0 +1,74 @@
+package ignition
+
+import "container/heap"
+
+// 借出优先级，数值越大越先获得名额
+const (
+	PriorityLow    = -10
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// 等待名额的调用方
+type waiter struct {
+	priority int
+	seq      uint64        // 入队序号，同优先级先到先得
+	ready    chan struct{} // 获得名额或连接池关闭时写入
+	granted  bool          // 已获得名额，由p.mu保护
+	slot     bool          // 获得的是否为名额（MaxActive取消限制时为false）
+	index    int
+}
+
+// 等待队列
+// 按优先级从高到低，同优先级按入队顺序
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int {
+	return len(q)
+}
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*q = old[:n-1]
+	return w
+}
+
+// 入队
+func (q *waitQueue) push(w *waiter) {
+	heap.Push(q, w)
+}
+
+// 取出优先级最高的调用方
+func (q *waitQueue) pop() *waiter {
+	return heap.Pop(q).(*waiter)
+}
+
+// 移除调用方
+func (q *waitQueue) remove(w *waiter) {
+	if w.index >= 0 {
+		heap.Remove(q, w.index)
+	}
+}
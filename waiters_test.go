@@ -0,0 +1,72 @@
+package ignition
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPoolWaitQueue(t *testing.T) {
+	p := newTestPool(1, 1)
+	defer p.Close()
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+
+	order := make(chan string, 4)
+	enqueue := func(name string, priority int) {
+		n := p.Stats().Waiting
+		go func() {
+			pc, err := p.GetPriority(context.Background(), priority)
+			assert.Nil(t, err)
+			order <- name
+			time.Sleep(5 * time.Millisecond)
+			assert.Nil(t, pc.Close())
+		}()
+		for p.Stats().Waiting == n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	enqueue("low1", PriorityLow)
+	enqueue("normal1", PriorityNormal)
+	enqueue("low2", PriorityLow)
+	enqueue("high", PriorityHigh)
+
+	assert.Nil(t, pc.Close())
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, <-order)
+	}
+	assert.Equal(t, []string{"high", "normal1", "low1", "low2"}, got)
+}
+
+func TestPoolWaitQueueCancel(t *testing.T) {
+	p := newTestPool(1, 1)
+
+	pc, err := p.Get()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := p.GetContext(ctx)
+		errs <- err
+	}()
+	go func() {
+		_, err := p.Get()
+		errs <- err
+	}()
+	for p.Stats().Waiting < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	assert.Equal(t, context.Canceled, <-errs)
+	assert.Equal(t, 1, p.Stats().Waiting)
+
+	// closing the pool wakes up the remaining waiter
+	assert.Nil(t, p.Close())
+	assert.Equal(t, ErrPoolClosed, <-errs)
+	assert.Equal(t, 0, p.Stats().Waiting)
+	assert.Nil(t, pc.Close())
+}